@@ -0,0 +1,108 @@
+package policy_client
+
+import "fmt"
+
+// Direction picks which policies of an app to copy.
+type Direction string
+
+const (
+	// Inbound policies have the app as their destination.
+	Inbound Direction = "inbound"
+	// Outbound policies have the app as their source.
+	Outbound Direction = "outbound"
+	// BothDirections copies inbound and outbound policies.
+	BothDirections Direction = "both"
+)
+
+// ReplaceResult lists the policies ReplaceApp added and deleted.
+type ReplaceResult struct {
+	Added   []Policy `json:"added"`
+	Deleted []Policy `json:"deleted"`
+}
+
+// CopyPolicies gives toAppGUID the policies fromAppGUID has in direction.
+// A policy from the app to itself is copied as a policy from toAppGUID to
+// itself. It returns the policies it added, leaving out ones that already
+// existed.
+func (c *ExternalClient) CopyPolicies(token, fromAppGUID, toAppGUID string, direction Direction) ([]Policy, error) {
+	if direction != Inbound && direction != Outbound && direction != BothDirections {
+		return nil, fmt.Errorf("invalid direction %q", direction)
+	}
+	if fromAppGUID == toAppGUID {
+		return nil, fmt.Errorf("cannot copy policies of %s to itself", fromAppGUID)
+	}
+
+	current, err := c.GetPoliciesByID(token, fromAppGUID, toAppGUID)
+	if err != nil {
+		return nil, err
+	}
+	existing := NewPolicySet(current...)
+
+	copies := &PolicySet{}
+	for _, policy := range current {
+		outbound := policy.Source.ID == fromAppGUID
+		inbound := policy.Destination.ID == fromAppGUID
+		selfReferencing := outbound && inbound
+		if !selfReferencing && !(outbound && direction != Inbound) && !(inbound && direction != Outbound) {
+			continue
+		}
+
+		copied := Policy{
+			Source:      Source{ID: policy.Source.ID},
+			Destination: policy.Destination,
+		}
+		copied.Destination.Tag = ""
+		if outbound {
+			copied.Source.ID = toAppGUID
+		}
+		if inbound {
+			copied.Destination.ID = toAppGUID
+		}
+		if !existing.Contains(copied) {
+			copies.Add(copied)
+		}
+	}
+
+	added := copies.Slice()
+	if len(added) == 0 {
+		return added, nil
+	}
+	err = c.AddPolicies(token, added)
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// ReplaceApp moves every policy of oldGUID to newGUID: it copies them in
+// both directions, then deletes the policies of oldGUID. Nothing is
+// deleted when the copy fails.
+func (c *ExternalClient) ReplaceApp(token, oldGUID, newGUID string) (ReplaceResult, error) {
+	added, err := c.CopyPolicies(token, oldGUID, newGUID, BothDirections)
+	if err != nil {
+		return ReplaceResult{}, fmt.Errorf("copying policies: %w", err)
+	}
+	result := ReplaceResult{Added: added}
+
+	current, err := c.GetPoliciesByID(token, oldGUID)
+	if err != nil {
+		return result, err
+	}
+	old := &PolicySet{}
+	for _, policy := range current {
+		if policy.Source.ID == oldGUID || policy.Destination.ID == oldGUID {
+			old.Add(policy)
+		}
+	}
+
+	result.Deleted = old.Slice()
+	if len(result.Deleted) == 0 {
+		return result, nil
+	}
+	err = c.DeletePolicies(token, result.Deleted)
+	if err != nil {
+		result.Deleted = nil
+		return result, fmt.Errorf("deleting policies: %w", err)
+	}
+	return result, nil
+}
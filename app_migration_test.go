@@ -0,0 +1,144 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App migration", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		server     *policy_client.PolicySet
+		deleteErr  error
+	)
+
+	BeforeEach(func() {
+		tagged := testPolicy("app-old", "app-b", 8080, 8080)
+		tagged.Source.Tag = "0001"
+		tagged.Destination.Tag = "0002"
+		server = policy_client.NewPolicySet(
+			tagged,
+			testPolicy("app-c", "app-old", 9000, 9000),
+			testPolicy("app-old", "app-old", 7000, 7000),
+			testPolicy("app-c", "app-b", 443, 443),
+		)
+		deleteErr = nil
+
+		jsonClient = &hfakes.JSONClient{}
+		jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+			switch {
+			case method == "GET":
+				ids := strings.Split(strings.TrimPrefix(route, "/networking/v1/external/policies?id="), ",")
+				matching := []policy_client.Policy{}
+				for _, policy := range server.Slice() {
+					if slices.Contains(ids, policy.Source.ID) || slices.Contains(ids, policy.Destination.ID) {
+						matching = append(matching, policy)
+					}
+				}
+				body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": matching})
+				return json.Unmarshal(body, respData)
+			case route == "/networking/v1/external/policies":
+				server.Add(reqData.(map[string][]policy_client.Policy)["policies"]...)
+			case route == "/networking/v1/external/policies/delete":
+				if deleteErr != nil {
+					return deleteErr
+				}
+				server.Remove(reqData.(map[string][]policy_client.Policy)["policies"]...)
+			}
+			return nil
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+			Chunker:    &policy_client.SimpleChunker{ChunkSize: 1},
+		}
+	})
+
+	Describe("CopyPolicies", func() {
+		It("copies outbound policies without their tags", func() {
+			added, err := client.CopyPolicies("some-token", "app-old", "app-new", policy_client.Outbound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(added).To(Equal([]policy_client.Policy{
+				testPolicy("app-new", "app-b", 8080, 8080),
+				testPolicy("app-new", "app-new", 7000, 7000),
+			}))
+			Expect(server.Contains(testPolicy("app-new", "app-b", 8080, 8080))).To(BeTrue())
+		})
+
+		It("copies inbound policies", func() {
+			added, err := client.CopyPolicies("some-token", "app-old", "app-new", policy_client.Inbound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(added).To(Equal([]policy_client.Policy{
+				testPolicy("app-c", "app-new", 9000, 9000),
+				testPolicy("app-new", "app-new", 7000, 7000),
+			}))
+		})
+
+		It("only returns policies that did not exist", func() {
+			server.Add(testPolicy("app-c", "app-new", 9000, 9000))
+			added, err := client.CopyPolicies("some-token", "app-old", "app-new", policy_client.BothDirections)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(added).To(HaveLen(2))
+			Expect(jsonClient.DoCallCount()).To(Equal(3))
+		})
+
+		It("does not post when there is nothing to copy", func() {
+			added, err := client.CopyPolicies("some-token", "app-unknown", "app-new", policy_client.BothDirections)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(added).To(BeEmpty())
+			Expect(jsonClient.DoCallCount()).To(Equal(1))
+		})
+
+		It("rejects an invalid direction or copying an app to itself", func() {
+			_, err := client.CopyPolicies("some-token", "app-old", "app-new", "sideways")
+			Expect(err).To(MatchError(`invalid direction "sideways"`))
+			_, err = client.CopyPolicies("some-token", "app-old", "app-old", policy_client.Inbound)
+			Expect(err).To(MatchError("cannot copy policies of app-old to itself"))
+			Expect(jsonClient.DoCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("ReplaceApp", func() {
+		It("moves every policy to the new app", func() {
+			result, err := client.ReplaceApp("some-token", "app-old", "app-new")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Added).To(HaveLen(3))
+			Expect(result.Deleted).To(HaveLen(3))
+
+			Expect(server.Equal(policy_client.NewPolicySet(
+				testPolicy("app-new", "app-b", 8080, 8080),
+				testPolicy("app-c", "app-new", 9000, 9000),
+				testPolicy("app-new", "app-new", 7000, 7000),
+				testPolicy("app-c", "app-b", 443, 443),
+			))).To(BeTrue())
+		})
+
+		Context("when deleting fails", func() {
+			It("reports what was added", func() {
+				deleteErr = errors.New("banana")
+				result, err := client.ReplaceApp("some-token", "app-old", "app-new")
+				Expect(err).To(MatchError("deleting policies: banana"))
+				Expect(result.Added).To(HaveLen(3))
+				Expect(result.Deleted).To(BeEmpty())
+			})
+		})
+
+		Context("when copying fails", func() {
+			It("deletes nothing", func() {
+				jsonClient.DoStub = nil
+				jsonClient.DoReturns(errors.New("banana"))
+				_, err := client.ReplaceApp("some-token", "app-old", "app-new")
+				Expect(err).To(MatchError("copying policies: banana"))
+				Expect(jsonClient.DoCallCount()).To(Equal(1))
+			})
+		})
+	})
+})
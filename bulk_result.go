@@ -0,0 +1,185 @@
+package policy_client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultConcurrency = 1
+
+// BulkResult describes how far a chunked mutation got.
+type BulkResult[T any] struct {
+	// Succeeded holds the policies the policy server applied.
+	Succeeded []T
+	// Failed holds the policies of each chunk that failed, with its error.
+	Failed []ChunkError[T]
+	// NotAttempted holds the chunks that were never posted.
+	NotAttempted [][]T
+}
+
+type ChunkError[T any] struct {
+	Policies []T
+	Err      error
+}
+
+func (e ChunkError[T]) Error() string {
+	return e.Err.Error()
+}
+
+func (e ChunkError[T]) Unwrap() error {
+	return e.Err
+}
+
+// BulkError is returned by the mutation methods of ExternalClient when a
+// chunk fails. Its Result tells callers which policies to resume from.
+type BulkError[T any] struct {
+	Result BulkResult[T]
+}
+
+func (e *BulkError[T]) Error() string {
+	if len(e.Result.Failed) == 1 {
+		return e.Result.Failed[0].Error()
+	}
+	return fmt.Sprintf("%d chunks failed, first: %s", len(e.Result.Failed), e.Result.Failed[0].Error())
+}
+
+func (e *BulkError[T]) Unwrap() []error {
+	errs := make([]error, len(e.Result.Failed))
+	for i, failed := range e.Result.Failed {
+		errs[i] = failed.Err
+	}
+	return errs
+}
+
+// RollbackError is returned in AllOrNothing mode when a chunk fails. Err
+// is the failure and RollbackErr is the error undoing the applied chunks,
+// or nil when they were undone.
+type RollbackError struct {
+	Err         error
+	RollbackErr error
+}
+
+func (e *RollbackError) Error() string {
+	if e.RollbackErr == nil {
+		return fmt.Sprintf("rolled back: %s", e.Err)
+	}
+	return fmt.Sprintf("%s: rollback failed: %s", e.Err, e.RollbackErr)
+}
+
+func (e *RollbackError) Unwrap() []error {
+	if e.RollbackErr == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.RollbackErr}
+}
+
+// rollback undoes the policies err reports as applied, skipping those
+// that did not change anything on the server.
+func rollback[T any](err error, changed func(T) bool, undo func(applied []T) error) error {
+	var bulkErr *BulkError[T]
+	if !errors.As(err, &bulkErr) {
+		return err
+	}
+	var applied []T
+	for _, policy := range bulkErr.Result.Succeeded {
+		if changed(policy) {
+			applied = append(applied, policy)
+		}
+	}
+	if len(applied) == 0 {
+		return err
+	}
+	return &RollbackError{Err: err, RollbackErr: undo(applied)}
+}
+
+// convertBulkError converts the policies in a BulkError, or in the errors
+// of a RollbackError, for a method that posted the other policy version.
+func convertBulkError[From, To any](err error, convert func(From) To) error {
+	switch err := err.(type) {
+	case *RollbackError:
+		return &RollbackError{
+			Err:         convertBulkError(err.Err, convert),
+			RollbackErr: convertBulkError(err.RollbackErr, convert),
+		}
+	case *BulkError[From]:
+		result := BulkResult[To]{Succeeded: convertEach(err.Result.Succeeded, convert)}
+		for _, failed := range err.Result.Failed {
+			result.Failed = append(result.Failed, ChunkError[To]{Policies: convertEach(failed.Policies, convert), Err: failed.Err})
+		}
+		for _, chunk := range err.Result.NotAttempted {
+			result.NotAttempted = append(result.NotAttempted, convertEach(chunk, convert))
+		}
+		return &BulkError[To]{Result: result}
+	}
+	return err
+}
+
+func convertEach[From, To any](policies []From, convert func(From) To) []To {
+	if policies == nil {
+		return nil
+	}
+	result := make([]To, len(policies))
+	for i, policy := range policies {
+		result[i] = convert(policy)
+	}
+	return result
+}
+
+func (c *ExternalClient) getConcurrency() int {
+	if c.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return c.Concurrency
+}
+
+// submitChunks posts up to Concurrency chunks at once and stops starting
+// new ones after a failure.
+func submitChunks[T any](c *ExternalClient, chunks [][]T, post func([]T) error) error {
+	type outcome struct {
+		attempted bool
+		applied   int
+		err       error
+	}
+	outcomes := make([]outcome, len(chunks))
+
+	var (
+		failed atomic.Bool
+		wg     sync.WaitGroup
+	)
+	slots := make(chan struct{}, c.getConcurrency())
+	for i := range chunks {
+		slots <- struct{}{}
+		if failed.Load() {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			applied, err := postAdaptively(c, chunks[i], post)
+			outcomes[i] = outcome{attempted: true, applied: applied, err: err}
+			if err != nil {
+				failed.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var result BulkResult[T]
+	for i, o := range outcomes {
+		if !o.attempted {
+			result.NotAttempted = append(result.NotAttempted, chunks[i])
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, chunks[i][:o.applied]...)
+		if o.err != nil {
+			result.Failed = append(result.Failed, ChunkError[T]{Policies: chunks[i][o.applied:], Err: o.err})
+		}
+	}
+	if len(result.Failed) == 0 {
+		return nil
+	}
+	return &BulkError[T]{Result: result}
+}
@@ -0,0 +1,376 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/json_client"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bulk submission", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		policies   []policy_client.PolicyV0
+	)
+
+	postedPolicies := func(reqData interface{}) []policy_client.PolicyV0 {
+		return reqData.(map[string][]policy_client.PolicyV0)["policies"]
+	}
+
+	BeforeEach(func() {
+		jsonClient = &hfakes.JSONClient{}
+		policies = nil
+		for i := 0; i < 5; i++ {
+			policies = append(policies, policy_client.PolicyV0{
+				Source:      policy_client.SourceV0{ID: fmt.Sprintf("app-%d", i)},
+				Destination: policy_client.DestinationV0{ID: "some-other-app-guid", Port: 8080, Protocol: "tcp"},
+			})
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+			Chunker:    &policy_client.SimpleChunker{ChunkSize: 1},
+		}
+	})
+
+	Context("when a chunk fails", func() {
+		BeforeEach(func() {
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				if postedPolicies(reqData)[0].Source.ID == "app-2" {
+					return &json_client.HttpResponseCodeError{StatusCode: http.StatusTeapot, Message: "some-error"}
+				}
+				return nil
+			}
+		})
+
+		It("returns a BulkError listing the succeeded, failed and unattempted chunks", func() {
+			err := client.AddPoliciesV0("some-token", policies)
+			Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+
+			var bulkErr *policy_client.BulkError[policy_client.PolicyV0]
+			Expect(errors.As(err, &bulkErr)).To(BeTrue())
+			Expect(bulkErr.Result.Succeeded).To(Equal(policies[0:2]))
+			Expect(bulkErr.Result.Failed).To(HaveLen(1))
+			Expect(bulkErr.Result.Failed[0].Policies).To(Equal(policies[2:3]))
+			Expect(bulkErr.Result.NotAttempted).To(Equal([][]policy_client.PolicyV0{policies[3:4], policies[4:5]}))
+
+			var serverErr *policy_client.PolicyServerError
+			Expect(errors.As(err, &serverErr)).To(BeTrue())
+			Expect(serverErr.StatusCode).To(Equal(http.StatusTeapot))
+			Expect(serverErr.Message).To(Equal("some-error"))
+		})
+
+		It("reports the same for deletes", func() {
+			err := client.DeletePoliciesV0("some-token", policies)
+			var bulkErr *policy_client.BulkError[policy_client.PolicyV0]
+			Expect(errors.As(err, &bulkErr)).To(BeTrue())
+			Expect(bulkErr.Result.Succeeded).To(Equal(policies[0:2]))
+			Expect(bulkErr.Result.NotAttempted).To(HaveLen(2))
+		})
+	})
+
+	Context("when part of a split chunk was applied", func() {
+		BeforeEach(func() {
+			client.Chunker = &policy_client.SimpleChunker{ChunkSize: 5}
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				posted := postedPolicies(reqData)
+				if len(posted) > 2 {
+					return &json_client.HttpResponseCodeError{StatusCode: http.StatusRequestEntityTooLarge, Message: "too large"}
+				}
+				if posted[0].Source.ID == "app-3" {
+					return errors.New("banana")
+				}
+				return nil
+			}
+		})
+
+		It("reports only the unapplied policies as failed", func() {
+			err := client.AddPoliciesV0("some-token", policies)
+			var bulkErr *policy_client.BulkError[policy_client.PolicyV0]
+			Expect(errors.As(err, &bulkErr)).To(BeTrue())
+			Expect(bulkErr.Result.Succeeded).To(Equal(policies[0:3]))
+			Expect(bulkErr.Result.Failed[0].Policies).To(Equal(policies[3:]))
+			Expect(bulkErr.Result.Failed[0].Err).To(MatchError("banana"))
+		})
+	})
+
+	Context("when Concurrency is set", func() {
+		BeforeEach(func() {
+			client.Concurrency = 3
+		})
+
+		It("posts up to that many chunks at once", func() {
+			var inFlight, maxInFlight int32
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				n := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+				for {
+					seen := atomic.LoadInt32(&maxInFlight)
+					if n <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}
+
+			Expect(client.AddPoliciesV0("some-token", policies)).To(Succeed())
+			Expect(jsonClient.DoCallCount()).To(Equal(5))
+			Expect(atomic.LoadInt32(&maxInFlight)).To(BeNumerically("<=", 3))
+			Expect(atomic.LoadInt32(&maxInFlight)).To(BeNumerically(">", 1))
+		})
+
+		It("lists every failed chunk in order", func() {
+			var (
+				calls int32
+				once  sync.Once
+			)
+			firstBatch := make(chan struct{})
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				if atomic.AddInt32(&calls, 1) >= 3 {
+					once.Do(func() { close(firstBatch) })
+				}
+				<-firstBatch
+				id := postedPolicies(reqData)[0].Source.ID
+				if id == "app-0" || id == "app-1" {
+					return errors.New("failed " + id)
+				}
+				return nil
+			}
+
+			err := client.AddPoliciesV0("some-token", policies)
+			var bulkErr *policy_client.BulkError[policy_client.PolicyV0]
+			Expect(errors.As(err, &bulkErr)).To(BeTrue())
+			Expect(bulkErr.Result.Failed).To(HaveLen(2))
+			Expect(bulkErr.Result.Failed[0].Policies).To(Equal(policies[0:1]))
+			Expect(bulkErr.Result.Failed[1].Policies).To(Equal(policies[1:2]))
+			Expect(err).To(MatchError("2 chunks failed, first: failed app-0"))
+
+			accounted := len(bulkErr.Result.Succeeded) + len(bulkErr.Result.NotAttempted) + len(bulkErr.Result.Failed)
+			Expect(accounted).To(Equal(5))
+		})
+	})
+
+	Context("when AllOrNothing is set", func() {
+		var (
+			routes   []string
+			existing []policy_client.PolicyV0
+		)
+
+		// serve answers the get of the current policies from existing and
+		// passes posts to post.
+		serve := func(post func(route string, reqData interface{}) error) func(string, string, interface{}, interface{}, string) error {
+			return func(method, route string, reqData, respData interface{}, token string) error {
+				if method == "GET" {
+					var body []byte
+					if strings.HasPrefix(route, "/networking/v1/") {
+						body, _ = json.Marshal(map[string][]policy_client.Policy{"policies": policy_client.PoliciesToV1(existing)})
+					} else {
+						body, _ = json.Marshal(map[string][]policy_client.PolicyV0{"policies": existing})
+					}
+					return json.Unmarshal(body, respData)
+				}
+				routes = append(routes, route)
+				return post(route, reqData)
+			}
+		}
+
+		BeforeEach(func() {
+			client.AllOrNothing = true
+			routes = nil
+			existing = nil
+			jsonClient.DoStub = serve(func(route string, reqData interface{}) error {
+				if postedPolicies(reqData)[0].Source.ID == "app-2" && route == "/networking/v0/external/policies" {
+					return errors.New("banana")
+				}
+				return nil
+			})
+		})
+
+		It("gets the current policies of the apps first", func() {
+			client.AddPoliciesV0("some-token", policies)
+			method, route, _, _, _ := jsonClient.DoArgsForCall(0)
+			Expect(method).To(Equal("GET"))
+			Expect(route).To(Equal("/networking/v0/external/policies?id=app-0,app-1,app-2,app-3,app-4,some-other-app-guid"))
+		})
+
+		It("gets the current policies in batches of app IDs", func() {
+			for i := len(policies); i < 150; i++ {
+				policies = append(policies, policy_client.PolicyV0{
+					Source:      policy_client.SourceV0{ID: fmt.Sprintf("app-%d", i)},
+					Destination: policy_client.DestinationV0{ID: "some-other-app-guid", Port: 8080, Protocol: "tcp"},
+				})
+			}
+			client.AddPoliciesV0("some-token", policies)
+
+			var ids []string
+			for i := 0; i < jsonClient.DoCallCount(); i++ {
+				method, route, _, _, _ := jsonClient.DoArgsForCall(i)
+				if method != "GET" {
+					continue
+				}
+				batch := strings.Split(strings.TrimPrefix(route, "/networking/v0/external/policies?id="), ",")
+				Expect(len(batch)).To(BeNumerically("<=", 100))
+				ids = append(ids, batch...)
+			}
+			Expect(ids).To(HaveLen(151))
+			Expect(ids).To(ContainElements("app-0", "app-149", "some-other-app-guid"))
+		})
+
+		It("deletes the policies a failed add applied", func() {
+			err := client.AddPoliciesV0("some-token", policies)
+			Expect(err).To(MatchError("rolled back: banana"))
+
+			var rollbackErr *policy_client.RollbackError
+			Expect(errors.As(err, &rollbackErr)).To(BeTrue())
+			Expect(rollbackErr.RollbackErr).NotTo(HaveOccurred())
+
+			Expect(routes).To(Equal([]string{
+				"/networking/v0/external/policies",
+				"/networking/v0/external/policies",
+				"/networking/v0/external/policies",
+				"/networking/v0/external/policies/delete",
+				"/networking/v0/external/policies/delete",
+			}))
+			_, _, reqData, _, _ := jsonClient.DoArgsForCall(4)
+			Expect(postedPolicies(reqData)).To(Equal(policies[0:1]))
+			_, _, reqData, _, _ = jsonClient.DoArgsForCall(5)
+			Expect(postedPolicies(reqData)).To(Equal(policies[1:2]))
+		})
+
+		Context("when an added policy already exists", func() {
+			BeforeEach(func() {
+				existing = policies[0:1]
+			})
+
+			It("does not delete it", func() {
+				err := client.AddPoliciesV0("some-token", policies)
+				Expect(err).To(MatchError("rolled back: banana"))
+
+				Expect(routes).To(Equal([]string{
+					"/networking/v0/external/policies",
+					"/networking/v0/external/policies",
+					"/networking/v0/external/policies",
+					"/networking/v0/external/policies/delete",
+				}))
+				_, _, reqData, _, _ := jsonClient.DoArgsForCall(4)
+				Expect(postedPolicies(reqData)).To(Equal(policies[1:2]))
+			})
+		})
+
+		Context("when only existing policies were applied", func() {
+			BeforeEach(func() {
+				existing = policies[0:2]
+			})
+
+			It("returns the error unchanged", func() {
+				err := client.AddPoliciesV0("some-token", policies)
+				Expect(err).To(MatchError("banana"))
+				var rollbackErr *policy_client.RollbackError
+				Expect(errors.As(err, &rollbackErr)).To(BeFalse())
+				Expect(routes).To(HaveLen(3))
+			})
+		})
+
+		It("re-adds the policies a failed delete applied", func() {
+			existing = policies
+			jsonClient.DoStub = serve(func(route string, reqData interface{}) error {
+				posted := reqData.(map[string][]policy_client.Policy)["policies"]
+				if posted[0].Source.ID == "app-1" && route == "/networking/v1/external/policies/delete" {
+					return errors.New("banana")
+				}
+				return nil
+			})
+			v1Policies := policy_client.PoliciesToV1(policies)
+
+			err := client.DeletePolicies("some-token", v1Policies)
+			Expect(err).To(MatchError("rolled back: banana"))
+			Expect(routes).To(Equal([]string{
+				"/networking/v1/external/policies/delete",
+				"/networking/v1/external/policies/delete",
+				"/networking/v1/external/policies",
+			}))
+			_, _, reqData, _, _ := jsonClient.DoArgsForCall(3)
+			Expect(reqData).To(Equal(map[string][]policy_client.Policy{"policies": v1Policies[0:1]}))
+		})
+
+		Context("when a deleted policy did not exist", func() {
+			It("does not re-add it", func() {
+				existing = policies[1:]
+				jsonClient.DoStub = serve(func(route string, reqData interface{}) error {
+					posted := reqData.(map[string][]policy_client.Policy)["policies"]
+					if posted[0].Source.ID == "app-2" && route == "/networking/v1/external/policies/delete" {
+						return errors.New("banana")
+					}
+					return nil
+				})
+				v1Policies := policy_client.PoliciesToV1(policies)
+
+				err := client.DeletePolicies("some-token", v1Policies)
+				Expect(err).To(MatchError("rolled back: banana"))
+				Expect(routes).To(HaveLen(4))
+				_, route, reqData, _, _ := jsonClient.DoArgsForCall(4)
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(reqData).To(Equal(map[string][]policy_client.Policy{"policies": v1Policies[1:2]}))
+			})
+		})
+
+		It("reports both errors when the rollback fails", func() {
+			jsonClient.DoStub = serve(func(route string, reqData interface{}) error {
+				if route == "/networking/v0/external/policies/delete" {
+					return &json_client.HttpResponseCodeError{StatusCode: http.StatusTeapot, Message: "some-error"}
+				}
+				if postedPolicies(reqData)[0].Source.ID == "app-2" {
+					return errors.New("banana")
+				}
+				return nil
+			})
+
+			err := client.AddPoliciesV0("some-token", policies)
+			Expect(err).To(MatchError("banana: rollback failed: 418 I'm a teapot: some-error"))
+
+			var rollbackErr *policy_client.RollbackError
+			Expect(errors.As(err, &rollbackErr)).To(BeTrue())
+			var undoErr *policy_client.BulkError[policy_client.PolicyV0]
+			Expect(errors.As(rollbackErr.RollbackErr, &undoErr)).To(BeTrue())
+			Expect(undoErr.Result.Failed[0].Policies).To(Equal(policies[0:1]))
+			Expect(undoErr.Result.NotAttempted).To(Equal([][]policy_client.PolicyV0{policies[1:2]}))
+		})
+
+		It("returns the error unchanged when nothing was applied", func() {
+			jsonClient.DoStub = serve(func(route string, reqData interface{}) error {
+				return errors.New("banana")
+			})
+
+			err := client.AddPoliciesV0("some-token", policies)
+			Expect(err).To(MatchError("banana"))
+			var rollbackErr *policy_client.RollbackError
+			Expect(errors.As(err, &rollbackErr)).To(BeFalse())
+			Expect(routes).To(HaveLen(1))
+		})
+
+		Context("when getting the current policies fails", func() {
+			It("returns the error without posting", func() {
+				jsonClient.DoStub = nil
+				jsonClient.DoReturns(errors.New("banana"))
+
+				err := client.AddPoliciesV0("some-token", policies)
+				Expect(err).To(MatchError("banana"))
+				Expect(jsonClient.DoCallCount()).To(Equal(1))
+				method, _, _, _, _ := jsonClient.DoArgsForCall(0)
+				Expect(method).To(Equal("GET"))
+			})
+		})
+	})
+})
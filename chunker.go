@@ -1,10 +1,24 @@
 package policy_client
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 const DefaultMaxPolicies = 100
 
+// DefaultMaxChunkBytes matches the default request body limit of common
+// proxies such as nginx.
+const DefaultMaxChunkBytes = 1 << 20
+
+// chunkEnvelope is the request body around the chunk, as sent by
+// ExternalClient.
+const chunkEnvelope = `{"policies":[]}`
+
 //go:generate counterfeiter -o ./fakes/chunker.go --fake-name Chunker . Chunker
 type Chunker interface {
-	Chunk(allPolicies []PolicyV0) [][]PolicyV0
+	Chunk(allPolicies []PolicyV0) ([][]PolicyV0, error)
+	ChunkPolicies(allPolicies []Policy) ([][]Policy, error)
 }
 
 type SimpleChunker struct {
@@ -25,11 +39,89 @@ func min(a, b int) int {
 	return b
 }
 
-func (c *SimpleChunker) Chunk(allPolicies []PolicyV0) [][]PolicyV0 {
-	chunkSize := c.getChunkSize()
-	chunkedPolicies := [][]PolicyV0{}
-	for i := 0; i < len(allPolicies); i += chunkSize {
-		chunkedPolicies = append(chunkedPolicies, allPolicies[i:min(len(allPolicies), i+chunkSize)])
+func (c *SimpleChunker) Chunk(allPolicies []PolicyV0) ([][]PolicyV0, error) {
+	return chunk(allPolicies, c.getChunkSize()), nil
+}
+
+func (c *SimpleChunker) ChunkPolicies(allPolicies []Policy) ([][]Policy, error) {
+	return chunk(allPolicies, c.getChunkSize()), nil
+}
+
+func chunk[T any](all []T, chunkSize int) [][]T {
+	chunked := [][]T{}
+	for i := 0; i < len(all); i += chunkSize {
+		chunked = append(chunked, all[i:min(len(all), i+chunkSize)])
+	}
+	return chunked
+}
+
+// PolicyTooLargeError is returned when a single policy does not fit in the
+// byte budget of a ByteSizeChunker.
+type PolicyTooLargeError struct {
+	Index    int
+	Size     int
+	MaxBytes int
+}
+
+func (e *PolicyTooLargeError) Error() string {
+	return fmt.Sprintf("policy %d needs a %d byte request body, more than the %d byte limit", e.Index, e.Size, e.MaxBytes)
+}
+
+// ByteSizeChunker splits policies so the JSON request body of each chunk
+// stays within MaxBytes, with at most MaxPolicies policies per chunk.
+type ByteSizeChunker struct {
+	MaxBytes    int
+	MaxPolicies int
+}
+
+func (c *ByteSizeChunker) getMaxBytes() int {
+	if c.MaxBytes <= 0 {
+		return DefaultMaxChunkBytes
+	}
+	return c.MaxBytes
+}
+
+func (c *ByteSizeChunker) getMaxPolicies() int {
+	if c.MaxPolicies <= 0 {
+		return DefaultMaxPolicies
+	}
+	return c.MaxPolicies
+}
+
+func (c *ByteSizeChunker) Chunk(allPolicies []PolicyV0) ([][]PolicyV0, error) {
+	return chunkBySize(allPolicies, c.getMaxBytes(), c.getMaxPolicies())
+}
+
+func (c *ByteSizeChunker) ChunkPolicies(allPolicies []Policy) ([][]Policy, error) {
+	return chunkBySize(allPolicies, c.getMaxBytes(), c.getMaxPolicies())
+}
+
+func chunkBySize[T any](all []T, maxBytes, maxPolicies int) ([][]T, error) {
+	chunked := [][]T{}
+	start, size := 0, len(chunkEnvelope)
+	for i, policy := range all {
+		encoded, err := json.Marshal(policy)
+		if err != nil {
+			return nil, err
+		}
+		policySize := len(encoded)
+		if len(chunkEnvelope)+policySize > maxBytes {
+			return nil, &PolicyTooLargeError{Index: i, Size: len(chunkEnvelope) + policySize, MaxBytes: maxBytes}
+		}
+
+		if i > start {
+			// separating comma
+			policySize++
+		}
+		if i > start && (size+policySize > maxBytes || i-start == maxPolicies) {
+			chunked = append(chunked, all[start:i])
+			start, size = i, len(chunkEnvelope)
+			policySize = len(encoded)
+		}
+		size += policySize
+	}
+	if start < len(all) {
+		chunked = append(chunked, all[start:])
 	}
-	return chunkedPolicies
+	return chunked, nil
 }
@@ -1,6 +1,10 @@
 package policy_client_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
 	"code.cloudfoundry.org/policy_client"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -53,7 +57,8 @@ var _ = Describe("SimpleChunker", func() {
 			}
 		})
 		It("returns the last chunk as smaller than ChunkSize", func() {
-			chunkedPolicies := chunker.Chunk(policies)
+			chunkedPolicies, err := chunker.Chunk(policies)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(len(chunkedPolicies)).To(Equal(2))
 			Expect(chunkedPolicies[0]).To(Equal(policies[0:2]))
 			Expect(chunkedPolicies[1]).To(Equal(policies[2:]))
@@ -67,9 +72,112 @@ var _ = Describe("SimpleChunker", func() {
 			}
 		})
 		It("chunks with a chunk size of DefaultMaxPolicies", func() {
-			chunkedPolicies := chunker.Chunk(policies)
+			chunkedPolicies, err := chunker.Chunk(policies)
+			Expect(err).NotTo(HaveOccurred())
 			Expect(len(chunkedPolicies)).To(Equal(1))
 			Expect(chunkedPolicies[0]).To(Equal(policies))
 		})
 	})
+
+	Describe("ChunkPolicies", func() {
+		It("chunks v1 policies the same way", func() {
+			chunker = policy_client.SimpleChunker{ChunkSize: 2}
+			v1Policies := []policy_client.Policy{
+				{Source: policy_client.Source{ID: "some-app-guid"}},
+				{Source: policy_client.Source{ID: "some-app-guid-2"}},
+				{Source: policy_client.Source{ID: "some-app-guid-3"}},
+			}
+			chunkedPolicies, err := chunker.ChunkPolicies(v1Policies)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chunkedPolicies).To(Equal([][]policy_client.Policy{v1Policies[0:2], v1Policies[2:]}))
+		})
+
+		It("returns no chunks for no policies", func() {
+			chunkedPolicies, err := chunker.ChunkPolicies(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chunkedPolicies).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("ByteSizeChunker", func() {
+	var (
+		chunker  policy_client.ByteSizeChunker
+		policies []policy_client.PolicyV0
+	)
+
+	bodySize := func(chunk []policy_client.PolicyV0) int {
+		body, err := json.Marshal(map[string][]policy_client.PolicyV0{"policies": chunk})
+		Expect(err).NotTo(HaveOccurred())
+		return len(body)
+	}
+
+	BeforeEach(func() {
+		chunker = policy_client.ByteSizeChunker{}
+		policies = []policy_client.PolicyV0{
+			{
+				Source:      policy_client.SourceV0{ID: "some-app-guid"},
+				Destination: policy_client.DestinationV0{ID: "some-other-app-guid", Port: 8090, Protocol: "tcp"},
+			},
+			{
+				Source:      policy_client.SourceV0{ID: "some-app-guid-with-a-much-longer-guid"},
+				Destination: policy_client.DestinationV0{ID: "some-other-app-guid-2", Port: 8091, Protocol: "tcp"},
+			},
+			{
+				Source:      policy_client.SourceV0{ID: "some-app-guid-3"},
+				Destination: policy_client.DestinationV0{ID: "some-other-app-guid-3", Port: 8092, Protocol: "tcp"},
+			},
+		}
+	})
+
+	It("splits so every request body fits in MaxBytes", func() {
+		chunker = policy_client.ByteSizeChunker{MaxBytes: bodySize(policies[0:2])}
+		chunkedPolicies, err := chunker.Chunk(policies)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunkedPolicies).To(Equal([][]policy_client.PolicyV0{policies[0:2], policies[2:]}))
+
+		chunker.MaxBytes--
+		chunkedPolicies, err = chunker.Chunk(policies)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunkedPolicies).To(Equal([][]policy_client.PolicyV0{policies[0:1], policies[1:2], policies[2:]}))
+	})
+
+	It("also limits the number of policies per chunk", func() {
+		chunker = policy_client.ByteSizeChunker{MaxBytes: 1 << 20, MaxPolicies: 2}
+		chunkedPolicies, err := chunker.Chunk(policies)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunkedPolicies).To(Equal([][]policy_client.PolicyV0{policies[0:2], policies[2:]}))
+	})
+
+	It("uses the defaults when the limits are zero", func() {
+		chunkedPolicies, err := chunker.Chunk(policies)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunkedPolicies).To(Equal([][]policy_client.PolicyV0{policies}))
+	})
+
+	It("chunks v1 policies", func() {
+		v1Policies := []policy_client.Policy{
+			{Source: policy_client.Source{ID: "some-app-guid"}},
+			{Source: policy_client.Source{ID: "some-app-guid-2"}},
+		}
+		body, err := json.Marshal(map[string][]policy_client.Policy{"policies": v1Policies})
+		Expect(err).NotTo(HaveOccurred())
+		chunker = policy_client.ByteSizeChunker{MaxBytes: len(body) - 1}
+		chunkedPolicies, err := chunker.ChunkPolicies(v1Policies)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunkedPolicies).To(Equal([][]policy_client.Policy{v1Policies[0:1], v1Policies[1:]}))
+	})
+
+	Context("when a single policy is over the budget", func() {
+		It("returns a PolicyTooLargeError", func() {
+			size := bodySize(policies[1:2])
+			chunker = policy_client.ByteSizeChunker{MaxBytes: size - 1}
+			_, err := chunker.Chunk(policies)
+			Expect(err).To(MatchError(fmt.Sprintf("policy 1 needs a %d byte request body, more than the %d byte limit", size, size-1)))
+
+			var tooLarge *policy_client.PolicyTooLargeError
+			Expect(errors.As(err, &tooLarge)).To(BeTrue())
+			Expect(tooLarge.Index).To(Equal(1))
+		})
+	})
 })
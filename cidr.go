@@ -0,0 +1,162 @@
+package policy_client
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// RangeToPrefixes returns the smallest set of prefixes that covers start
+// to end inclusive. Both addresses must be of the same family. IPv6 zones
+// are ignored, as prefixes cannot have one.
+func RangeToPrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	start, end = start.Unmap().WithZone(""), end.Unmap().WithZone("")
+	first := start
+	if !start.IsValid() || !end.IsValid() || start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("invalid ip range %s-%s", start, end)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("invalid ip range %s-%s: start is after end", start, end)
+	}
+
+	var prefixes []netip.Prefix
+	for {
+		found := false
+		for length := 0; length <= start.BitLen(); length++ {
+			prefix := netip.PrefixFrom(start, length).Masked()
+			if prefix.Addr() != start || end.Less(lastAddr(prefix)) {
+				continue
+			}
+			prefixes = append(prefixes, prefix)
+			start = lastAddr(prefix).Next()
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid ip range %s-%s: no prefix starts at %s", first, end, start)
+		}
+		if !start.IsValid() || end.Less(start) {
+			return prefixes, nil
+		}
+	}
+}
+
+// MergePrefixes returns the smallest set of prefixes covering the same
+// addresses as the input, with overlapping and adjacent prefixes combined.
+// IPv4 prefixes sort before IPv6 prefixes.
+func MergePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	type addrRange struct {
+		start, end netip.Addr
+	}
+
+	ranges := make([]addrRange, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if !prefix.IsValid() {
+			continue
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefix = prefix.Masked()
+		ranges = append(ranges, addrRange{start: prefix.Addr(), end: lastAddr(prefix)})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+
+	var merged []addrRange
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			next := last.end.Next()
+			if last.start.Is4() == r.start.Is4() && (!next.IsValid() || !next.Less(r.start)) {
+				if last.end.Less(r.end) {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	var result []netip.Prefix
+	for _, r := range merged {
+		p, _ := RangeToPrefixes(r.start, r.end)
+		result = append(result, p...)
+	}
+	return result
+}
+
+// Prefixes returns the range as the smallest set of covering prefixes.
+func (r IPRange) Prefixes() ([]netip.Prefix, error) {
+	start, err := netip.ParseAddr(r.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip range start %q", r.Start)
+	}
+	end, err := netip.ParseAddr(r.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip range end %q", r.End)
+	}
+	return RangeToPrefixes(start, end)
+}
+
+// DestinationPrefixes parses the comma-separated destinations of the rule,
+// which may be addresses, CIDRs or start-end ranges, and returns them as a
+// merged set of prefixes.
+func (r SecurityGroupRule) DestinationPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, destination := range strings.Split(r.Destination, ",") {
+		destination = strings.TrimSpace(destination)
+		if destination == "" {
+			continue
+		}
+		p, err := parseDestination(destination)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p...)
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("invalid destination %q", r.Destination)
+	}
+	return MergePrefixes(prefixes), nil
+}
+
+func parseDestination(destination string) ([]netip.Prefix, error) {
+	if start, end, ok := strings.Cut(destination, "-"); ok {
+		p, err := IPRange{Start: strings.TrimSpace(start), End: strings.TrimSpace(end)}.Prefixes()
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		return p, nil
+	}
+	if strings.Contains(destination, "/") {
+		prefix, err := netip.ParsePrefix(destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		return []netip.Prefix{prefix.Masked()}, nil
+	}
+	addr, err := netip.ParseAddr(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %q", destination)
+	}
+	return []netip.Prefix{netip.PrefixFrom(addr.WithZone(""), addr.BitLen())}, nil
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As16()
+	offset := 0
+	if prefix.Addr().Is4() {
+		offset = 96
+	}
+	for i := offset + prefix.Bits(); i < 128; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr := netip.AddrFrom16(b)
+	if prefix.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
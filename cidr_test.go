@@ -0,0 +1,129 @@
+package policy_client_test
+
+import (
+	"net/netip"
+
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func prefixes(cidrs ...string) []netip.Prefix {
+	var result []netip.Prefix
+	for _, cidr := range cidrs {
+		result = append(result, netip.MustParsePrefix(cidr))
+	}
+	return result
+}
+
+var _ = Describe("CIDR conversion", func() {
+	Describe("RangeToPrefixes", func() {
+		DescribeTable("returns the minimal covering prefixes",
+			func(start, end string, expected []netip.Prefix) {
+				result, err := policy_client.RangeToPrefixes(netip.MustParseAddr(start), netip.MustParseAddr(end))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(expected))
+			},
+			Entry("single address", "10.0.0.1", "10.0.0.1", prefixes("10.0.0.1/32")),
+			Entry("aligned block", "10.0.0.0", "10.0.0.255", prefixes("10.0.0.0/24")),
+			Entry("unaligned range", "10.0.0.1", "10.0.0.6", prefixes("10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32")),
+			Entry("public networks", "0.0.0.0", "9.255.255.255", prefixes("0.0.0.0/5", "8.0.0.0/7")),
+			Entry("whole ipv4 space", "0.0.0.0", "255.255.255.255", prefixes("0.0.0.0/0")),
+			Entry("end of ipv4 space", "255.255.255.254", "255.255.255.255", prefixes("255.255.255.254/31")),
+			Entry("ipv6 range", "2001:db8::", "2001:db8::2", prefixes("2001:db8::/127", "2001:db8::2/128")),
+			Entry("whole ipv6 space", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", prefixes("::/0")),
+			Entry("zoned ipv6 range", "fe80::1%eth0", "fe80::4%eth0", prefixes("fe80::1/128", "fe80::2/127", "fe80::4/128")),
+		)
+
+		Context("when the addresses are of different families", func() {
+			It("returns an error", func() {
+				_, err := policy_client.RangeToPrefixes(netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("::1"))
+				Expect(err).To(MatchError("invalid ip range 10.0.0.1-::1"))
+			})
+		})
+
+		Context("when start is after end", func() {
+			It("returns an error", func() {
+				_, err := policy_client.RangeToPrefixes(netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1"))
+				Expect(err).To(MatchError("invalid ip range 10.0.0.2-10.0.0.1: start is after end"))
+			})
+		})
+	})
+
+	Describe("MergePrefixes", func() {
+		It("combines overlapping and adjacent prefixes", func() {
+			result := policy_client.MergePrefixes(prefixes(
+				"10.0.1.0/24",
+				"2001:db8::1/128",
+				"10.0.0.0/24",
+				"10.0.0.128/25",
+				"2001:db8::/128",
+				"192.168.0.1/32",
+			))
+			Expect(result).To(Equal(prefixes(
+				"10.0.0.0/23",
+				"192.168.0.1/32",
+				"2001:db8::/127",
+			)))
+		})
+
+		It("does not merge across address families", func() {
+			result := policy_client.MergePrefixes(prefixes("255.255.255.255/32", "::/128"))
+			Expect(result).To(Equal(prefixes("255.255.255.255/32", "::/128")))
+		})
+
+		It("normalises ipv4-mapped prefixes", func() {
+			result := policy_client.MergePrefixes(prefixes("::ffff:10.0.0.0/120", "10.0.1.0/24"))
+			Expect(result).To(Equal(prefixes("10.0.0.0/23")))
+		})
+	})
+
+	Describe("IPRange.Prefixes", func() {
+		It("converts the range", func() {
+			result, err := policy_client.IPRange{Start: "1.2.3.4", End: "1.2.3.5"}.Prefixes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(prefixes("1.2.3.4/31")))
+		})
+
+		Context("when an address is invalid", func() {
+			It("returns an error", func() {
+				_, err := policy_client.IPRange{Start: "1.2.3", End: "1.2.3.5"}.Prefixes()
+				Expect(err).To(MatchError(`invalid ip range start "1.2.3"`))
+			})
+		})
+	})
+
+	Describe("SecurityGroupRule.DestinationPrefixes", func() {
+		It("normalises addresses, CIDRs and ranges", func() {
+			rule := policy_client.SecurityGroupRule{
+				Destination: "10.0.0.5-10.0.0.7, 10.0.0.4,10.0.0.0/30,2001:db8::1",
+			}
+			result, err := rule.DestinationPrefixes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(prefixes("10.0.0.0/29", "2001:db8::1/128")))
+		})
+
+		It("drops IPv6 zones", func() {
+			rule := policy_client.SecurityGroupRule{Destination: "fe80::1%eth0-fe80::2,fe80::9%eth0"}
+			result, err := rule.DestinationPrefixes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(prefixes("fe80::1/128", "fe80::2/128", "fe80::9/128")))
+		})
+
+		Context("when a destination is invalid", func() {
+			It("returns an error", func() {
+				rule := policy_client.SecurityGroupRule{Destination: "10.0.0.0/8,banana"}
+				_, err := rule.DestinationPrefixes()
+				Expect(err).To(MatchError(`invalid destination "banana"`))
+			})
+		})
+
+		Context("when there are no destinations", func() {
+			It("returns an error", func() {
+				_, err := policy_client.SecurityGroupRule{}.DestinationPrefixes()
+				Expect(err).To(MatchError(`invalid destination ""`))
+			})
+		})
+	})
+})
@@ -1,9 +1,12 @@
 package policy_client
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"code.cloudfoundry.org/cf-networking-helpers/json_client"
 	"code.cloudfoundry.org/lager/v3"
@@ -15,17 +18,63 @@ type ExternalPolicyClient interface {
 	GetPoliciesByID(token string, ids ...string) ([]Policy, error)
 	GetPoliciesV0(token string) ([]PolicyV0, error)
 	GetPoliciesV0ByID(token string, ids ...string) ([]PolicyV0, error)
-	DeletePolicies(token string, policies []Policy) error
-	DeletePoliciesV0(token string, policies []PolicyV0) error
-	AddPolicies(token string, policies []Policy) error
-	AddPoliciesV0(token string, policies []PolicyV0) error
+	DeletePolicies(token string, policies []Policy, opts ...MutationOption) error
+	DeletePoliciesV0(token string, policies []PolicyV0, opts ...MutationOptionV0) error
+	AddPolicies(token string, policies []Policy, opts ...MutationOption) error
+	AddPoliciesV0(token string, policies []PolicyV0, opts ...MutationOptionV0) error
 }
 
 type ExternalClient struct {
 	JsonClient json_client.JsonClient
 	Chunker    Chunker
+
+	// ServeV0FromV1 makes the V0 methods call the v1 routes and convert,
+	// for policy servers that no longer serve the v0 routes. Getting a
+	// policy whose port range has more than one port returns an error.
+	ServeV0FromV1 bool
+
+	// NegotiateAPIVersion makes the V0 methods call the v1 routes, as with
+	// ServeV0FromV1, when APIVersions finds the policy server only serves
+	// v1, and the v1 methods call the v0 routes when it only serves v0.
+	// Adding or deleting a policy whose port range expands to more than
+	// DefaultMaxV0Expansion v0 policies then returns an error.
+	NegotiateAPIVersion bool
+
+	// MinChunkSize is the smallest chunk a rejected chunk is split down
+	// to. A chunk rejected with a 413, or a 400 for too many policies, is
+	// split in half and retried, and later chunks are kept to the size that
+	// worked. DefaultMinChunkSize is used when it is zero or less.
+	MinChunkSize int
+
+	// AllOrNothing undoes the chunks already applied when a chunk fails,
+	// by deleting what an add applied or re-adding what a delete applied.
+	// The current policies of the apps are fetched before posting, so the
+	// undo skips policies an add found already existing, or a delete found
+	// already missing.
+	AllOrNothing bool
+
+	// ValidateBeforeAdd runs ValidatePolicies in AddPolicies and
+	// AddPoliciesV0, returning its ValidationError instead of posting.
+	ValidateBeforeAdd bool
+
+	// Guardrails are checked before every mutation, which returns a
+	// GuardrailError instead of posting when any is violated.
+	Guardrails []Guardrail
+
+	// Concurrency is how many chunks are posted at once. No new chunks are
+	// posted after one fails. DefaultConcurrency is used when it is zero or
+	// less.
+	Concurrency int
+
+	apiVersionsMutex sync.Mutex
+	apiVersions      *APIVersions
+
+	chunkSizeMutex sync.Mutex
+	chunkSize      int
 }
 
+const DefaultMinChunkSize = 1
+
 func NewExternal(logger lager.Logger, httpClient json_client.HttpClient, baseURL string) *ExternalClient {
 	return &ExternalClient{
 		JsonClient: json_client.New(logger, httpClient, baseURL),
@@ -34,10 +83,22 @@ func NewExternal(logger lager.Logger, httpClient json_client.HttpClient, baseURL
 }
 
 func (c *ExternalClient) GetPolicies(token string) ([]Policy, error) {
+	fromV0, err := c.serveV1FromV0(token)
+	if err != nil {
+		return nil, err
+	}
+	if fromV0 {
+		policies, err := c.GetPoliciesV0(token)
+		if err != nil {
+			return nil, err
+		}
+		return PoliciesToV1(policies), nil
+	}
+
 	var policies struct {
 		Policies []Policy `json:"policies"`
 	}
-	err := c.JsonClient.Do("GET", "/networking/v1/external/policies", nil, &policies, token)
+	err = c.JsonClient.Do("GET", "/networking/v1/external/policies", nil, &policies, token)
 	if err != nil {
 		return nil, parseHttpError(err)
 	}
@@ -45,11 +106,23 @@ func (c *ExternalClient) GetPolicies(token string) ([]Policy, error) {
 }
 
 func (c *ExternalClient) GetPoliciesByID(token string, ids ...string) ([]Policy, error) {
+	fromV0, err := c.serveV1FromV0(token)
+	if err != nil {
+		return nil, err
+	}
+	if fromV0 {
+		policies, err := c.GetPoliciesV0ByID(token, ids...)
+		if err != nil {
+			return nil, err
+		}
+		return PoliciesToV1(policies), nil
+	}
+
 	var policies struct {
 		Policies []Policy `json:"policies"`
 	}
 	route := "/networking/v1/external/policies?id=" + strings.Join(ids, ",")
-	err := c.JsonClient.Do("GET", route, nil, &policies, token)
+	err = c.JsonClient.Do("GET", route, nil, &policies, token)
 	if err != nil {
 		return nil, parseHttpError(err)
 	}
@@ -57,10 +130,22 @@ func (c *ExternalClient) GetPoliciesByID(token string, ids ...string) ([]Policy,
 }
 
 func (c *ExternalClient) GetPoliciesV0(token string) ([]PolicyV0, error) {
+	fromV1, err := c.serveV0FromV1(token)
+	if err != nil {
+		return nil, err
+	}
+	if fromV1 {
+		policies, err := c.GetPolicies(token)
+		if err != nil {
+			return nil, err
+		}
+		return v1PoliciesToV0(policies)
+	}
+
 	var policies struct {
 		Policies []PolicyV0 `json:"policies"`
 	}
-	err := c.JsonClient.Do("GET", "/networking/v0/external/policies", nil, &policies, token)
+	err = c.JsonClient.Do("GET", "/networking/v0/external/policies", nil, &policies, token)
 	if err != nil {
 		return nil, parseHttpError(err)
 	}
@@ -68,79 +153,471 @@ func (c *ExternalClient) GetPoliciesV0(token string) ([]PolicyV0, error) {
 }
 
 func (c *ExternalClient) GetPoliciesV0ByID(token string, ids ...string) ([]PolicyV0, error) {
+	fromV1, err := c.serveV0FromV1(token)
+	if err != nil {
+		return nil, err
+	}
+	if fromV1 {
+		policies, err := c.GetPoliciesByID(token, ids...)
+		if err != nil {
+			return nil, err
+		}
+		return v1PoliciesToV0(policies)
+	}
+
 	var policies struct {
 		Policies []PolicyV0 `json:"policies"`
 	}
 	route := "/networking/v0/external/policies?id=" + strings.Join(ids, ",")
-	err := c.JsonClient.Do("GET", route, nil, &policies, token)
+	err = c.JsonClient.Do("GET", route, nil, &policies, token)
 	if err != nil {
 		return nil, parseHttpError(err)
 	}
 	return policies.Policies, nil
 }
 
-func (c *ExternalClient) AddPolicies(token string, policies []Policy) error {
-	reqPolicies := map[string][]Policy{
-		"policies": policies,
+type mutationRoutes struct {
+	v0 string
+	v1 string
+}
+
+var (
+	addRoutes = mutationRoutes{
+		v0: "/networking/v0/external/policies",
+		v1: "/networking/v1/external/policies",
+	}
+	deleteRoutes = mutationRoutes{
+		v0: "/networking/v0/external/policies/delete",
+		v1: "/networking/v1/external/policies/delete",
+	}
+)
+
+func (c *ExternalClient) AddPolicies(token string, policies []Policy, opts ...MutationOption) error {
+	if c.ValidateBeforeAdd {
+		err := ValidatePolicies(policies)
+		if err != nil {
+			return err
+		}
+	}
+	err := c.checkGuardrails(token, MutationAdd, policies, false)
+	if err != nil {
+		return err
+	}
+	dryRun, err := c.planPolicies(token, newMutationOptions(opts), true, policies)
+	if dryRun {
+		return err
+	}
+	return c.postChunks(token, addRoutes, deleteRoutes, policies)
+}
+
+func (c *ExternalClient) AddPoliciesV0(token string, policies []PolicyV0, opts ...MutationOptionV0) error {
+	if c.ValidateBeforeAdd {
+		err := ValidatePolicies(PoliciesToV1(policies))
+		if err != nil {
+			return err
+		}
+	}
+	err := c.checkGuardrails(token, MutationAdd, PoliciesToV1(policies), true)
+	if err != nil {
+		return err
 	}
+	dryRun, err := c.planPoliciesV0(token, newMutationOptions(opts), true, policies)
+	if dryRun {
+		return err
+	}
+	return c.postV0Chunks(token, addRoutes, deleteRoutes, policies)
+}
 
-	err := c.JsonClient.Do("POST", "/networking/v1/external/policies", reqPolicies, nil, token)
+func (c *ExternalClient) DeletePolicies(token string, policies []Policy, opts ...MutationOption) error {
+	err := c.checkGuardrails(token, MutationDelete, policies, false)
 	if err != nil {
-		return parseHttpError(err)
+		return err
 	}
+	dryRun, err := c.planPolicies(token, newMutationOptions(opts), false, policies)
+	if dryRun {
+		return err
+	}
+	return c.postChunks(token, deleteRoutes, addRoutes, policies)
+}
 
-	return nil
+func (c *ExternalClient) DeletePoliciesV0(token string, policies []PolicyV0, opts ...MutationOptionV0) error {
+	err := c.checkGuardrails(token, MutationDelete, PoliciesToV1(policies), true)
+	if err != nil {
+		return err
+	}
+	dryRun, err := c.planPoliciesV0(token, newMutationOptions(opts), false, policies)
+	if dryRun {
+		return err
+	}
+	return c.postV0Chunks(token, deleteRoutes, addRoutes, policies)
 }
 
-func (c *ExternalClient) AddPoliciesV0(token string, policies []PolicyV0) error {
-	chunks := c.Chunker.Chunk(policies)
-	for _, chunk := range chunks {
-		reqPolicies := map[string][]PolicyV0{
-			"policies": chunk,
+func (c *ExternalClient) checkGuardrails(token string, mutation Mutation, policies []Policy, v0 bool) error {
+	if len(c.Guardrails) == 0 {
+		return nil
+	}
+	existing := func(appIDs ...string) ([]Policy, error) {
+		if !v0 {
+			return c.GetPoliciesByID(token, appIDs...)
+		}
+		// v1 policies with a port range cannot be converted to v0
+		fromV1, err := c.serveV0FromV1(token)
+		if err != nil {
+			return nil, err
+		}
+		if fromV1 {
+			return c.GetPoliciesByID(token, appIDs...)
+		}
+		policies, err := c.GetPoliciesV0ByID(token, appIDs...)
+		return PoliciesToV1(policies), err
+	}
+	return CheckGuardrails(c.Guardrails, Change{Mutation: mutation, Policies: policies, Existing: existing})
+}
+
+func (c *ExternalClient) planPolicies(token string, opts mutationOptions[Policy], adding bool, policies []Policy) (bool, error) {
+	return planMutation(opts.dryRun, adding, policies, c.keysGetter(token), Policy.Key)
+}
+
+func (c *ExternalClient) planPoliciesV0(token string, opts mutationOptions[PolicyV0], adding bool, policies []PolicyV0) (bool, error) {
+	return planMutation(opts.dryRun, adding, policies, c.v0KeysGetter(token), v0Key)
+}
+
+// keysGetter gets the keys of the current policies of apps.
+func (c *ExternalClient) keysGetter(token string) func(ids ...string) ([]PolicyKey, error) {
+	return func(ids ...string) ([]PolicyKey, error) {
+		policies, err := c.GetPoliciesByID(token, ids...)
+		return keysOf(policies, Policy.Key), err
+	}
+}
+
+// v0KeysGetter is keysGetter for the V0 methods. When serving v0 from v1
+// it gets v1 policies, as those with a port range cannot be converted.
+func (c *ExternalClient) v0KeysGetter(token string) func(ids ...string) ([]PolicyKey, error) {
+	return func(ids ...string) ([]PolicyKey, error) {
+		fromV1, err := c.serveV0FromV1(token)
+		if err != nil {
+			return nil, err
+		}
+		if fromV1 {
+			return c.keysGetter(token)(ids...)
+		}
+		policies, err := c.GetPoliciesV0ByID(token, ids...)
+		return keysOf(policies, v0Key), err
+	}
+}
+
+func keysOf[T any](policies []T, key func(T) PolicyKey) []PolicyKey {
+	keys := make([]PolicyKey, len(policies))
+	for i, policy := range policies {
+		keys[i] = key(policy)
+	}
+	return keys
+}
+
+func (c *ExternalClient) postChunks(token string, routes, undoRoutes mutationRoutes, policies []Policy) error {
+	fromV0, err := c.serveV1FromV0(token)
+	if err != nil {
+		return err
+	}
+	if fromV0 {
+		v0Policies, err := PoliciesToV0(policies)
+		if err != nil {
+			return fmt.Errorf("policy server only serves v0: %w", err)
 		}
-		err := c.JsonClient.Do("POST", "/networking/v0/external/policies", reqPolicies, nil, token)
+		return convertBulkError(c.postV0Chunks(token, routes, undoRoutes, v0Policies), ToV1)
+	}
+
+	submit := func(route string, policies []Policy) error {
+		chunks, err := c.Chunker.ChunkPolicies(policies)
 		if err != nil {
-			return parseHttpError(err)
+			return err
+		}
+		post := func(chunk []Policy) error {
+			reqPolicies := map[string][]Policy{
+				"policies": chunk,
+			}
+			return c.JsonClient.Do("POST", route, reqPolicies, nil, token)
 		}
+		return submitChunks(c, chunks, post)
 	}
-	return nil
+
+	if !c.AllOrNothing {
+		return submit(routes.v1, policies)
+	}
+	changed, err := plannedChanges(routes, policies, c.keysGetter(token), Policy.Key)
+	if err != nil {
+		return err
+	}
+	err = submit(routes.v1, policies)
+	return rollback(err, changed, func(applied []Policy) error {
+		return submit(undoRoutes.v1, applied)
+	})
 }
 
-func (c *ExternalClient) DeletePolicies(token string, policies []Policy) error {
-	reqPolicies := map[string][]Policy{
-		"policies": policies,
+// postV0Chunks posts v1 policies to the v1 routes when serving v0 from
+// v1, so the chunks are sized for the v1 encoding.
+func (c *ExternalClient) postV0Chunks(token string, routes, undoRoutes mutationRoutes, policies []PolicyV0) error {
+	fromV1, err := c.serveV0FromV1(token)
+	if err != nil {
+		return err
+	}
+	if fromV1 {
+		return convertBulkError(c.postChunks(token, routes, undoRoutes, PoliciesToV1(policies)), singlePortToV0)
+	}
+
+	submit := func(route string, policies []PolicyV0) error {
+		chunks, err := c.Chunker.Chunk(policies)
+		if err != nil {
+			return err
+		}
+		post := func(chunk []PolicyV0) error {
+			reqPolicies := map[string][]PolicyV0{
+				"policies": chunk,
+			}
+			return c.JsonClient.Do("POST", route, reqPolicies, nil, token)
+		}
+		return submitChunks(c, chunks, post)
 	}
 
-	err := c.JsonClient.Do("POST", "/networking/v1/external/policies/delete", reqPolicies, nil, token)
+	if !c.AllOrNothing {
+		return submit(routes.v0, policies)
+	}
+	changed, err := plannedChanges(routes, policies, c.v0KeysGetter(token), v0Key)
 	if err != nil {
-		return parseHttpError(err)
+		return err
 	}
+	err = submit(routes.v0, policies)
+	return rollback(err, changed, func(applied []PolicyV0) error {
+		return submit(undoRoutes.v0, applied)
+	})
+}
 
-	return nil
+// plannedChanges reports which policies the mutation on routes changes
+// on the server, for rolling back only those.
+func plannedChanges[T Policy | PolicyV0](routes mutationRoutes, policies []T, getKeysByID func(ids ...string) ([]PolicyKey, error), key func(T) PolicyKey) (func(T) bool, error) {
+	plan, err := newMutationPlan(routes == addRoutes, policies, getKeysByID, key)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[PolicyKey]bool{}
+	for _, policy := range plan.Changes {
+		changes[key(policy)] = true
+	}
+	return func(policy T) bool {
+		return changes[key(policy)]
+	}, nil
 }
 
-func (c *ExternalClient) DeletePoliciesV0(token string, policies []PolicyV0) error {
-	chunks := c.Chunker.Chunk(policies)
-	for _, chunk := range chunks {
-		reqPolicies := map[string][]PolicyV0{
-			"policies": chunk,
+func v0Key(policy PolicyV0) PolicyKey {
+	return ToV1(policy).Key()
+}
+
+// postAdaptively posts a chunk, first splitting it to the chunk size that
+// last worked. A chunk the server rejects as too large is split in half and
+// both halves are retried, down to MinChunkSize. It returns how many
+// policies from the start of the chunk were applied.
+func postAdaptively[T any](c *ExternalClient, all []T, post func([]T) error) (int, error) {
+	if size := c.getChunkSize(); size > 0 && len(all) > size {
+		applied := 0
+		for _, part := range chunk(all, size) {
+			n, err := postAdaptively(c, part, post)
+			applied += n
+			if err != nil {
+				return applied, err
+			}
 		}
-		err := c.JsonClient.Do("POST", "/networking/v0/external/policies/delete", reqPolicies, nil, token)
+		return applied, nil
+	}
+
+	err := post(all)
+	if err == nil {
+		return len(all), nil
+	}
+	half := (len(all) + 1) / 2
+	if !isChunkTooLarge(err) || len(all) <= c.getMinChunkSize() || half < c.getMinChunkSize() {
+		return 0, parseHttpError(err)
+	}
+
+	c.setChunkSize(half)
+	applied, err := postAdaptively(c, all[:half], post)
+	if err != nil {
+		return applied, err
+	}
+	n, err := postAdaptively(c, all[half:], post)
+	return applied + n, err
+}
+
+func isChunkTooLarge(err error) bool {
+	httpErr, ok := err.(*json_client.HttpResponseCodeError)
+	if !ok {
+		return false
+	}
+	switch httpErr.StatusCode {
+	case http.StatusRequestEntityTooLarge:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(strings.ToLower(httpErr.Message), "too many policies")
+	}
+	return false
+}
+
+func (c *ExternalClient) getMinChunkSize() int {
+	if c.MinChunkSize <= 0 {
+		return DefaultMinChunkSize
+	}
+	return c.MinChunkSize
+}
+
+func (c *ExternalClient) getChunkSize() int {
+	c.chunkSizeMutex.Lock()
+	defer c.chunkSizeMutex.Unlock()
+	return c.chunkSize
+}
+
+// setChunkSize remembers the smallest chunk size needed so far.
+func (c *ExternalClient) setChunkSize(size int) {
+	c.chunkSizeMutex.Lock()
+	defer c.chunkSizeMutex.Unlock()
+	if c.chunkSize == 0 || size < c.chunkSize {
+		c.chunkSize = size
+	}
+}
+
+func (c *ExternalClient) serveV0FromV1(token string) (bool, error) {
+	if c.ServeV0FromV1 {
+		return true, nil
+	}
+	if !c.NegotiateAPIVersion {
+		return false, nil
+	}
+	versions, err := c.APIVersions(token)
+	if err != nil {
+		return false, err
+	}
+	return versions.V1 && !versions.V0, nil
+}
+
+// serveV1FromV0 reports whether the v1 methods should call the v0 routes,
+// which is never the case with ServeV0FromV1.
+func (c *ExternalClient) serveV1FromV0(token string) (bool, error) {
+	if c.ServeV0FromV1 || !c.NegotiateAPIVersion {
+		return false, nil
+	}
+	versions, err := c.APIVersions(token)
+	if err != nil {
+		return false, err
+	}
+	return versions.V0 && !versions.V1, nil
+}
+
+// v1PoliciesToV0 only converts single port policies. Expanding a range
+// would return v0 policies that cannot be deleted individually.
+func v1PoliciesToV0(policies []Policy) ([]PolicyV0, error) {
+	converter := V0Converter{MaxExpansion: 1}
+	result := make([]PolicyV0, 0, len(policies))
+	for _, policy := range policies {
+		converted, err := converter.ToV0(policy)
 		if err != nil {
-			return parseHttpError(err)
+			return nil, fmt.Errorf("policy from %s to %s cannot be represented as a v0 policy: %w",
+				policy.Source.ID, policy.Destination.ID, err)
 		}
+		result = append(result, converted...)
 	}
-	return nil
+	return result, nil
+}
+
+// singlePortToV0 converts back a policy converted from a v0 policy.
+func singlePortToV0(policy Policy) PolicyV0 {
+	return PolicyV0{
+		Source: SourceToV0(policy.Source),
+		Destination: DestinationV0{
+			ID:       policy.Destination.ID,
+			Tag:      policy.Destination.Tag,
+			Protocol: policy.Destination.Protocol,
+			Port:     policy.Destination.Ports.Start,
+		},
+	}
+}
+
+type APIVersions struct {
+	V0 bool `json:"v0"`
+	V1 bool `json:"v1"`
+}
+
+// Preferred returns the newest supported version, "v1" or "v0".
+func (v APIVersions) Preferred() string {
+	if v.V1 {
+		return "v1"
+	}
+	return "v0"
+}
+
+const apiVersionProbeID = "policy-client-api-version-probe"
+
+// APIVersions probes which versions of the external policies API the
+// policy server serves. A version is unsupported when its route returns a
+// 404. The result is cached for the lifetime of the client; other errors
+// are returned and not cached.
+func (c *ExternalClient) APIVersions(token string) (APIVersions, error) {
+	c.apiVersionsMutex.Lock()
+	defer c.apiVersionsMutex.Unlock()
+
+	if c.apiVersions != nil {
+		return *c.apiVersions, nil
+	}
+
+	v1, err := c.probeAPIVersion(token, "/networking/v1/external/policies")
+	if err != nil {
+		return APIVersions{}, err
+	}
+	v0, err := c.probeAPIVersion(token, "/networking/v0/external/policies")
+	if err != nil {
+		return APIVersions{}, err
+	}
+	if !v0 && !v1 {
+		return APIVersions{}, errors.New("policy server serves neither the v0 nor the v1 external policies api")
+	}
+
+	c.apiVersions = &APIVersions{V0: v0, V1: v1}
+	return *c.apiVersions, nil
+}
+
+func (c *ExternalClient) probeAPIVersion(token, route string) (bool, error) {
+	var policies struct {
+		Policies []json.RawMessage `json:"policies"`
+	}
+	err := c.JsonClient.Do("GET", route+"?id="+apiVersionProbeID, nil, &policies, token)
+	if httpErr, ok := err.(*json_client.HttpResponseCodeError); ok && httpErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, parseHttpError(err)
+	}
+	return true, nil
+}
+
+// PolicyServerError is returned when the policy server responds with a bad
+// status code.
+type PolicyServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *PolicyServerError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode,
+		http.StatusText(e.StatusCode),
+		e.Message,
+	)
 }
 
 // Check if error is bad status code and parse out the JSON body
 func parseHttpError(err error) error {
 	httpErr, ok := err.(*json_client.HttpResponseCodeError)
 	if ok {
-		return fmt.Errorf("%d %s: %s", httpErr.StatusCode,
-			http.StatusText(httpErr.StatusCode),
-			httpErr.Message,
-		)
+		return &PolicyServerError{
+			StatusCode: httpErr.StatusCode,
+			Message:    httpErr.Message,
+		}
 	}
 	return err
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
 	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
 	"code.cloudfoundry.org/cf-networking-helpers/json_client"
@@ -13,6 +14,18 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// threeV0Policies returns the policies the fake chunker chunks by default.
+func threeV0Policies() []PolicyV0 {
+	policies := make([]PolicyV0, 3)
+	for i, suffix := range []string{"", "-2", "-3"} {
+		policies[i] = PolicyV0{
+			Source:      SourceV0{ID: "some-app-guid" + suffix},
+			Destination: DestinationV0{ID: "some-other-app-guid" + suffix, Port: 8090 + i, Protocol: "tcp"},
+		}
+	}
+	return policies
+}
+
 var _ = Describe("ExternalClient", func() {
 	var (
 		client      *ExternalClient
@@ -58,7 +71,10 @@ var _ = Describe("ExternalClient", func() {
 					},
 				},
 			},
-		})
+		}, nil)
+		fakeChunker.ChunkPoliciesStub = func(policies []Policy) ([][]Policy, error) {
+			return [][]Policy{policies}, nil
+		}
 		client = &ExternalClient{
 			JsonClient: jsonClient,
 			Chunker:    fakeChunker,
@@ -392,6 +408,16 @@ var _ = Describe("ExternalClient", func() {
 				Expect(err).To(MatchError("418 I'm a teapot: some-error"))
 			})
 		})
+		Context("when the chunker fails", func() {
+			BeforeEach(func() {
+				fakeChunker.ChunkReturns(nil, errors.New("potato"))
+			})
+			It("returns the error without posting", func() {
+				err := client.AddPoliciesV0("some-token", policiesToAdd)
+				Expect(err).To(MatchError("potato"))
+				Expect(jsonClient.DoCallCount()).To(Equal(0))
+			})
+		})
 	})
 
 	Describe("AddPolicies", func() {
@@ -430,6 +456,8 @@ var _ = Describe("ExternalClient", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(fakeChunker.ChunkCallCount()).To(Equal(0))
+			Expect(fakeChunker.ChunkPoliciesCallCount()).To(Equal(1))
+			Expect(fakeChunker.ChunkPoliciesArgsForCall(0)).To(Equal(policiesToAdd))
 
 			Expect(jsonClient.DoCallCount()).To(Equal(1))
 			method, route, reqData, _, token := jsonClient.DoArgsForCall(0)
@@ -481,6 +509,111 @@ var _ = Describe("ExternalClient", func() {
 				Expect(err).To(MatchError("418 I'm a teapot: some-error"))
 			})
 		})
+		Context("when the chunker fails", func() {
+			BeforeEach(func() {
+				fakeChunker.ChunkPoliciesStub = nil
+				fakeChunker.ChunkPoliciesReturns(nil, errors.New("potato"))
+			})
+			It("returns the error without posting", func() {
+				err := client.AddPolicies("some-token", policiesToAdd)
+				Expect(err).To(MatchError("potato"))
+				Expect(jsonClient.DoCallCount()).To(Equal(0))
+			})
+		})
+		Context("when the policies are split into several chunks", func() {
+			BeforeEach(func() {
+				fakeChunker.ChunkPoliciesStub = func(policies []Policy) ([][]Policy, error) {
+					return [][]Policy{policies[:1], policies[1:]}, nil
+				}
+			})
+			It("posts each chunk", func() {
+				err := client.AddPolicies("some-token", policiesToAdd)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(jsonClient.DoCallCount()).To(Equal(2))
+				_, route, reqData, _, _ := jsonClient.DoArgsForCall(0)
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(reqData).To(Equal(map[string][]Policy{"policies": policiesToAdd[:1]}))
+				_, route, reqData, _, _ = jsonClient.DoArgsForCall(1)
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(reqData).To(Equal(map[string][]Policy{"policies": policiesToAdd[1:]}))
+			})
+			It("stops at the first chunk that fails", func() {
+				jsonClient.DoReturnsOnCall(0, errors.New("banana"))
+				err := client.AddPolicies("some-token", policiesToAdd)
+				Expect(err).To(MatchError("banana"))
+				Expect(jsonClient.DoCallCount()).To(Equal(1))
+			})
+		})
+		Context("when the server rejects a chunk as too large", func() {
+			var postedSizes []int
+			BeforeEach(func() {
+				policiesToAdd = append(policiesToAdd, policiesToAdd...)
+				postedSizes = nil
+				jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+					size := len(reqData.(map[string][]Policy)["policies"])
+					postedSizes = append(postedSizes, size)
+					if size > 1 {
+						return &json_client.HttpResponseCodeError{
+							StatusCode: http.StatusRequestEntityTooLarge,
+							Message:    "request body too large",
+						}
+					}
+					return nil
+				}
+			})
+			It("splits the chunk in half and retries", func() {
+				err := client.AddPolicies("some-token", policiesToAdd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(postedSizes).To(Equal([]int{4, 2, 1, 1, 1, 1}))
+			})
+			It("remembers the chunk size that worked", func() {
+				Expect(client.AddPolicies("some-token", policiesToAdd)).To(Succeed())
+				postedSizes = nil
+				Expect(client.AddPolicies("some-token", policiesToAdd)).To(Succeed())
+				Expect(postedSizes).To(Equal([]int{1, 1, 1, 1}))
+			})
+			It("also splits on a 400 for too many policies", func() {
+				jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+					size := len(reqData.(map[string][]Policy)["policies"])
+					postedSizes = append(postedSizes, size)
+					if size > 2 {
+						return &json_client.HttpResponseCodeError{
+							StatusCode: http.StatusBadRequest,
+							Message:    `{"error": "too many policies: maximum is 2"}`,
+						}
+					}
+					return nil
+				}
+				err := client.AddPolicies("some-token", policiesToAdd)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(postedSizes).To(Equal([]int{4, 2, 2}))
+			})
+			Context("when the chunk cannot be split below MinChunkSize", func() {
+				BeforeEach(func() {
+					client.MinChunkSize = 2
+				})
+				It("returns the error", func() {
+					err := client.AddPolicies("some-token", policiesToAdd)
+					Expect(err).To(MatchError("413 Request Entity Too Large: request body too large"))
+					Expect(postedSizes).To(Equal([]int{4, 2}))
+				})
+			})
+			Context("when the server rejects the chunk for another reason", func() {
+				BeforeEach(func() {
+					jsonClient.DoStub = nil
+					jsonClient.DoReturns(&json_client.HttpResponseCodeError{
+						StatusCode: http.StatusBadRequest,
+						Message:    "some-error",
+					})
+				})
+				It("does not retry", func() {
+					err := client.AddPolicies("some-token", policiesToAdd)
+					Expect(err).To(MatchError("400 Bad Request: some-error"))
+					Expect(jsonClient.DoCallCount()).To(Equal(1))
+				})
+			})
+		})
 	})
 
 	Describe("DeletePoliciesV0", func() {
@@ -616,6 +749,8 @@ var _ = Describe("ExternalClient", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(fakeChunker.ChunkCallCount()).To(Equal(0))
+			Expect(fakeChunker.ChunkPoliciesCallCount()).To(Equal(1))
+			Expect(fakeChunker.ChunkPoliciesArgsForCall(0)).To(Equal(policiesToDelete))
 
 			Expect(jsonClient.DoCallCount()).To(Equal(1))
 			method, route, reqData, _, token := jsonClient.DoArgsForCall(0)
@@ -662,5 +797,473 @@ var _ = Describe("ExternalClient", func() {
 				Expect(err).To(MatchError("418 I'm a teapot: some-error"))
 			})
 		})
+		Context("when the policies are split into several chunks", func() {
+			BeforeEach(func() {
+				fakeChunker.ChunkPoliciesStub = func(policies []Policy) ([][]Policy, error) {
+					return [][]Policy{policies, policies}, nil
+				}
+			})
+			It("posts each chunk to the delete route", func() {
+				err := client.DeletePolicies("some-token", policiesToDelete)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(jsonClient.DoCallCount()).To(Equal(2))
+				_, route, _, _, _ := jsonClient.DoArgsForCall(1)
+				Expect(route).To(Equal("/networking/v1/external/policies/delete"))
+			})
+		})
+	})
+
+	Describe("ServeV0FromV1", func() {
+		BeforeEach(func() {
+			client.ServeV0FromV1 = true
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				respBytes := []byte(`{ "policies": [ {"source": { "id": "some-app-guid" }, "destination": { "id": "some-other-app-guid", "protocol": "tcp", "ports": { "start": 8090, "end": 8090 } } } ] }`)
+				json.Unmarshal(respBytes, respData)
+				return nil
+			}
+		})
+
+		Describe("GetPoliciesV0", func() {
+			It("gets the v1 policies and converts them", func() {
+				policies, err := client.GetPoliciesV0("some-token")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(jsonClient.DoCallCount()).To(Equal(1))
+				method, route, _, _, token := jsonClient.DoArgsForCall(0)
+				Expect(method).To(Equal("GET"))
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(token).To(Equal("some-token"))
+
+				Expect(policies).To(Equal([]PolicyV0{
+					{
+						Source: SourceV0{
+							ID: "some-app-guid",
+						},
+						Destination: DestinationV0{
+							ID:       "some-other-app-guid",
+							Port:     8090,
+							Protocol: "tcp",
+						},
+					},
+				}))
+			})
+
+			Context("when a v1 policy has a port range", func() {
+				BeforeEach(func() {
+					jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+						respBytes := []byte(`{ "policies": [ {"source": { "id": "some-app-guid" }, "destination": { "id": "some-other-app-guid", "protocol": "tcp", "ports": { "start": 8090, "end": 8100 } } } ] }`)
+						json.Unmarshal(respBytes, respData)
+						return nil
+					}
+				})
+				It("returns an error", func() {
+					_, err := client.GetPoliciesV0("some-token")
+					Expect(err).To(MatchError("policy from some-app-guid to some-other-app-guid cannot be represented as a v0 policy: cannot convert ports 8090-8100 to v0: expands to 11 policies, limit is 1"))
+
+					var conversionErr *V0ConversionError
+					Expect(errors.As(err, &conversionErr)).To(BeTrue())
+				})
+			})
+
+			Context("when the json client gets a bad status code", func() {
+				BeforeEach(func() {
+					jsonClient.DoStub = nil
+					jsonClient.DoReturns(&json_client.HttpResponseCodeError{
+						StatusCode: http.StatusTeapot,
+						Message:    "some-error",
+					})
+				})
+				It("parses out the error body", func() {
+					_, err := client.GetPoliciesV0("some-token")
+					Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+				})
+			})
+		})
+
+		Describe("GetPoliciesV0ByID", func() {
+			It("gets the v1 policies and converts them", func() {
+				policies, err := client.GetPoliciesV0ByID("some-token", "some-app-guid", "another-app-guid")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, route, _, _, _ := jsonClient.DoArgsForCall(0)
+				Expect(route).To(Equal("/networking/v1/external/policies?id=some-app-guid,another-app-guid"))
+				Expect(policies).To(HaveLen(1))
+				Expect(policies[0].Destination.Port).To(Equal(8090))
+			})
+		})
+
+		Describe("AddPoliciesV0", func() {
+			var v0Policies []PolicyV0
+
+			BeforeEach(func() {
+				v0Policies = threeV0Policies()
+				fakeChunker.ChunkPoliciesStub = func(policies []Policy) ([][]Policy, error) {
+					return [][]Policy{policies[:2], policies[2:]}, nil
+				}
+			})
+
+			It("chunks the v1 policies and posts each chunk to the v1 route", func() {
+				err := client.AddPoliciesV0("some-token", v0Policies)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeChunker.ChunkPoliciesCallCount()).To(Equal(1))
+				Expect(fakeChunker.ChunkPoliciesArgsForCall(0)).To(Equal(PoliciesToV1(v0Policies)))
+
+				Expect(jsonClient.DoCallCount()).To(Equal(2))
+				method, route, reqData, _, token := jsonClient.DoArgsForCall(0)
+				Expect(method).To(Equal("POST"))
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(token).To(Equal("some-token"))
+				Expect(reqData).To(Equal(map[string][]Policy{
+					"policies": {
+						{
+							Source:      Source{ID: "some-app-guid"},
+							Destination: Destination{ID: "some-other-app-guid", Protocol: "tcp", Ports: Ports{Start: 8090, End: 8090}},
+						},
+						{
+							Source:      Source{ID: "some-app-guid-2"},
+							Destination: Destination{ID: "some-other-app-guid-2", Protocol: "tcp", Ports: Ports{Start: 8091, End: 8091}},
+						},
+					},
+				}))
+
+				_, route, reqData, _, _ = jsonClient.DoArgsForCall(1)
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+				Expect(reqData).To(Equal(map[string][]Policy{
+					"policies": {
+						{
+							Source:      Source{ID: "some-app-guid-3"},
+							Destination: Destination{ID: "some-other-app-guid-3", Protocol: "tcp", Ports: Ports{Start: 8092, End: 8092}},
+						},
+					},
+				}))
+			})
+
+			Context("when a chunk fails", func() {
+				BeforeEach(func() {
+					jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+						if jsonClient.DoCallCount() == 2 {
+							return &json_client.HttpResponseCodeError{StatusCode: http.StatusTeapot, Message: "some-error"}
+						}
+						return nil
+					}
+				})
+
+				It("returns the v0 policies in the bulk result", func() {
+					err := client.AddPoliciesV0("some-token", v0Policies)
+
+					var bulkErr *BulkError[PolicyV0]
+					Expect(errors.As(err, &bulkErr)).To(BeTrue())
+					Expect(bulkErr.Result.Succeeded).To(Equal(v0Policies[:2]))
+					Expect(bulkErr.Result.Failed).To(HaveLen(1))
+					Expect(bulkErr.Result.Failed[0].Policies).To(Equal(v0Policies[2:]))
+				})
+			})
+
+			Context("when chunking by size", func() {
+				It("sizes the chunks for the v1 encoding", func() {
+					client.Chunker = &ByteSizeChunker{MaxBytes: 1000}
+					policies := make([]PolicyV0, 40)
+					for i := range policies {
+						policies[i] = PolicyV0{
+							Source:      SourceV0{ID: "some-app-guid"},
+							Destination: DestinationV0{ID: "some-other-app-guid", Protocol: "tcp", Port: 8000 + i},
+						}
+					}
+
+					err := client.AddPoliciesV0("some-token", policies)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(jsonClient.DoCallCount()).To(BeNumerically(">", 1))
+					var posted []Policy
+					for i := 0; i < jsonClient.DoCallCount(); i++ {
+						_, _, reqData, _, _ := jsonClient.DoArgsForCall(i)
+						body, err := json.Marshal(reqData)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(body)).To(BeNumerically("<=", 1000))
+						posted = append(posted, reqData.(map[string][]Policy)["policies"]...)
+					}
+					Expect(posted).To(Equal(PoliciesToV1(policies)))
+				})
+			})
+		})
+
+		Describe("DeletePoliciesV0", func() {
+			It("posts each chunk to the v1 delete route", func() {
+				fakeChunker.ChunkPoliciesStub = func(policies []Policy) ([][]Policy, error) {
+					return [][]Policy{policies[:2], policies[2:]}, nil
+				}
+				err := client.DeletePoliciesV0("some-token", threeV0Policies())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(jsonClient.DoCallCount()).To(Equal(2))
+				_, route, reqData, _, _ := jsonClient.DoArgsForCall(0)
+				Expect(route).To(Equal("/networking/v1/external/policies/delete"))
+				Expect(reqData).To(HaveKeyWithValue("policies", HaveLen(2)))
+				_, route, _, _, _ = jsonClient.DoArgsForCall(1)
+				Expect(route).To(Equal("/networking/v1/external/policies/delete"))
+			})
+
+			Context("when the json client gets a bad status code", func() {
+				BeforeEach(func() {
+					jsonClient.DoStub = nil
+					jsonClient.DoReturns(&json_client.HttpResponseCodeError{
+						StatusCode: http.StatusTeapot,
+						Message:    "some-error",
+					})
+				})
+				It("parses out the error body", func() {
+					err := client.DeletePoliciesV0("some-token", []PolicyV0{})
+					Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+				})
+			})
+		})
+	})
+
+	Describe("APIVersions", func() {
+		var missingRoutes map[string]bool
+
+		BeforeEach(func() {
+			missingRoutes = map[string]bool{}
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				path := strings.SplitN(route, "?", 2)[0]
+				if missingRoutes[path] {
+					return &json_client.HttpResponseCodeError{StatusCode: http.StatusNotFound, Message: "404 page not found"}
+				}
+				json.Unmarshal([]byte(`{ "policies": [] }`), respData)
+				return nil
+			}
+		})
+
+		It("probes both versions with a filtered get", func() {
+			versions, err := client.APIVersions("some-token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(APIVersions{V0: true, V1: true}))
+			Expect(versions.Preferred()).To(Equal("v1"))
+
+			Expect(jsonClient.DoCallCount()).To(Equal(2))
+			method, route, reqData, _, token := jsonClient.DoArgsForCall(0)
+			Expect(method).To(Equal("GET"))
+			Expect(route).To(Equal("/networking/v1/external/policies?id=policy-client-api-version-probe"))
+			Expect(reqData).To(BeNil())
+			Expect(token).To(Equal("some-token"))
+			_, route, _, _, _ = jsonClient.DoArgsForCall(1)
+			Expect(route).To(Equal("/networking/v0/external/policies?id=policy-client-api-version-probe"))
+		})
+
+		It("caches the result", func() {
+			_, err := client.APIVersions("some-token")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.APIVersions("some-token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jsonClient.DoCallCount()).To(Equal(2))
+		})
+
+		Context("when the v1 route is missing", func() {
+			BeforeEach(func() {
+				missingRoutes["/networking/v1/external/policies"] = true
+			})
+			It("falls back to v0", func() {
+				versions, err := client.APIVersions("some-token")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(versions).To(Equal(APIVersions{V0: true, V1: false}))
+				Expect(versions.Preferred()).To(Equal("v0"))
+			})
+
+			Context("when NegotiateAPIVersion is set", func() {
+				BeforeEach(func() {
+					client.NegotiateAPIVersion = true
+					fakeChunker.ChunkStub = func(policies []PolicyV0) ([][]PolicyV0, error) {
+						return [][]PolicyV0{policies}, nil
+					}
+					probe := jsonClient.DoStub
+					jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+						if method == "GET" && route == "/networking/v0/external/policies?id=some-app" {
+							json.Unmarshal([]byte(`{ "policies": [
+								{ "source": { "id": "some-app" }, "destination": { "id": "some-other-app", "protocol": "tcp", "port": 8080 } }
+							] }`), respData)
+							return nil
+						}
+						return probe(method, route, reqData, respData, token)
+					}
+				})
+
+				It("gets the v0 policies and converts them", func() {
+					policies, err := client.GetPoliciesByID("some-token", "some-app")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(policies).To(Equal([]Policy{{
+						Source:      Source{ID: "some-app"},
+						Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 8080, End: 8080}},
+					}}))
+
+					Expect(jsonClient.DoCallCount()).To(Equal(3))
+					_, route, _, _, _ := jsonClient.DoArgsForCall(2)
+					Expect(route).To(Equal("/networking/v0/external/policies?id=some-app"))
+				})
+
+				It("queries the v0 policies by id and filters them", func() {
+					policies, err := client.QueryPolicies("some-token", NewPolicyQuery().SourceIDs("some-app").Port(8080))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(policies).To(Equal([]Policy{{
+						Source:      Source{ID: "some-app"},
+						Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 8080, End: 8080}},
+					}}))
+
+					policies, err = client.QueryPolicies("some-token", NewPolicyQuery().SourceIDs("some-app").Port(443))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(policies).To(BeEmpty())
+
+					Expect(jsonClient.DoCallCount()).To(Equal(4))
+					_, route, _, _, _ := jsonClient.DoArgsForCall(2)
+					Expect(route).To(Equal("/networking/v0/external/policies?id=some-app"))
+				})
+
+				It("queries every v0 policy without app filters", func() {
+					_, err := client.QueryPolicies("some-token", NewPolicyQuery().Protocol("tcp"))
+					Expect(err).NotTo(HaveOccurred())
+					_, route, _, _, _ := jsonClient.DoArgsForCall(2)
+					Expect(route).To(Equal("/networking/v0/external/policies"))
+				})
+
+				It("converts the policies and posts them to the v0 routes", func() {
+					err := client.AddPolicies("some-token", []Policy{{
+						Source:      Source{ID: "some-app"},
+						Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 8080, End: 8081}},
+					}})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(jsonClient.DoCallCount()).To(Equal(3))
+					method, route, reqData, _, _ := jsonClient.DoArgsForCall(2)
+					Expect(method).To(Equal("POST"))
+					Expect(route).To(Equal("/networking/v0/external/policies"))
+					Expect(reqData).To(Equal(map[string][]PolicyV0{
+						"policies": {
+							{Source: SourceV0{ID: "some-app"}, Destination: DestinationV0{ID: "some-other-app", Protocol: "tcp", Port: 8080}},
+							{Source: SourceV0{ID: "some-app"}, Destination: DestinationV0{ID: "some-other-app", Protocol: "tcp", Port: 8081}},
+						},
+					}))
+
+					err = client.DeletePolicies("some-token", []Policy{{
+						Source:      Source{ID: "some-app"},
+						Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 8080, End: 8080}},
+					}})
+					Expect(err).NotTo(HaveOccurred())
+					_, route, _, _, _ = jsonClient.DoArgsForCall(3)
+					Expect(route).To(Equal("/networking/v0/external/policies/delete"))
+				})
+
+				It("returns the failed policies as v1 policies", func() {
+					jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+						if method == "POST" {
+							return &json_client.HttpResponseCodeError{StatusCode: http.StatusTeapot, Message: "some-error"}
+						}
+						if strings.HasPrefix(route, "/networking/v1/") {
+							return &json_client.HttpResponseCodeError{StatusCode: http.StatusNotFound, Message: "404 page not found"}
+						}
+						return nil
+					}
+					policy := Policy{
+						Source:      Source{ID: "some-app"},
+						Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 8080, End: 8080}},
+					}
+					err := client.AddPolicies("some-token", []Policy{policy})
+
+					var bulkErr *BulkError[Policy]
+					Expect(errors.As(err, &bulkErr)).To(BeTrue())
+					Expect(bulkErr.Result.Failed).To(HaveLen(1))
+					Expect(bulkErr.Result.Failed[0].Policies).To(Equal([]Policy{policy}))
+				})
+
+				Context("when a port range cannot be converted", func() {
+					It("returns an error without posting", func() {
+						err := client.AddPolicies("some-token", []Policy{{
+							Source:      Source{ID: "some-app"},
+							Destination: Destination{ID: "some-other-app", Protocol: "tcp", Ports: Ports{Start: 1, End: 1000}},
+						}})
+						Expect(err).To(MatchError("policy server only serves v0: policy 0: cannot convert ports 1-1000 to v0: expands to 1000 policies, limit is 100"))
+						Expect(jsonClient.DoCallCount()).To(Equal(2))
+					})
+				})
+			})
+		})
+
+		Context("when the v0 route is missing", func() {
+			BeforeEach(func() {
+				missingRoutes["/networking/v0/external/policies"] = true
+			})
+			It("reports only v1", func() {
+				versions, err := client.APIVersions("some-token")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(versions).To(Equal(APIVersions{V0: false, V1: true}))
+			})
+
+			Context("when NegotiateAPIVersion is set", func() {
+				BeforeEach(func() {
+					client.NegotiateAPIVersion = true
+				})
+				It("serves the V0 methods from the v1 routes", func() {
+					_, err := client.GetPoliciesV0("some-token")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(jsonClient.DoCallCount()).To(Equal(3))
+					_, route, _, _, _ := jsonClient.DoArgsForCall(2)
+					Expect(route).To(Equal("/networking/v1/external/policies"))
+
+					err = client.AddPoliciesV0("some-token", []PolicyV0{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(jsonClient.DoCallCount()).To(Equal(4))
+					_, route, _, _, _ = jsonClient.DoArgsForCall(3)
+					Expect(route).To(Equal("/networking/v1/external/policies"))
+				})
+			})
+		})
+
+		Context("when NegotiateAPIVersion is set and both versions are served", func() {
+			BeforeEach(func() {
+				client.NegotiateAPIVersion = true
+			})
+			It("uses the v0 routes for the V0 methods", func() {
+				_, err := client.GetPoliciesV0("some-token")
+				Expect(err).NotTo(HaveOccurred())
+				_, route, _, _, _ := jsonClient.DoArgsForCall(2)
+				Expect(route).To(Equal("/networking/v0/external/policies"))
+			})
+		})
+
+		Context("when neither route exists", func() {
+			BeforeEach(func() {
+				missingRoutes["/networking/v0/external/policies"] = true
+				missingRoutes["/networking/v1/external/policies"] = true
+			})
+			It("returns an error", func() {
+				_, err := client.APIVersions("some-token")
+				Expect(err).To(MatchError("policy server serves neither the v0 nor the v1 external policies api"))
+			})
+		})
+
+		Context("when the probe fails with another error", func() {
+			BeforeEach(func() {
+				jsonClient.DoStub = nil
+				jsonClient.DoReturns(&json_client.HttpResponseCodeError{
+					StatusCode: http.StatusTeapot,
+					Message:    "some-error",
+				})
+			})
+			It("returns the error and does not cache", func() {
+				_, err := client.APIVersions("some-token")
+				Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+				_, err = client.APIVersions("some-token")
+				Expect(err).To(HaveOccurred())
+				Expect(jsonClient.DoCallCount()).To(Equal(2))
+			})
+
+			Context("when NegotiateAPIVersion is set", func() {
+				It("returns the error from the V0 methods", func() {
+					client.NegotiateAPIVersion = true
+					err := client.DeletePoliciesV0("some-token", []PolicyV0{})
+					Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+				})
+			})
+		})
 	})
 })
@@ -8,22 +8,37 @@ import (
 )
 
 type Chunker struct {
-	ChunkStub        func([]policy_client.PolicyV0) [][]policy_client.PolicyV0
+	ChunkStub        func([]policy_client.PolicyV0) ([][]policy_client.PolicyV0, error)
 	chunkMutex       sync.RWMutex
 	chunkArgsForCall []struct {
 		arg1 []policy_client.PolicyV0
 	}
 	chunkReturns struct {
 		result1 [][]policy_client.PolicyV0
+		result2 error
 	}
 	chunkReturnsOnCall map[int]struct {
 		result1 [][]policy_client.PolicyV0
+		result2 error
+	}
+	ChunkPoliciesStub        func([]policy_client.Policy) ([][]policy_client.Policy, error)
+	chunkPoliciesMutex       sync.RWMutex
+	chunkPoliciesArgsForCall []struct {
+		arg1 []policy_client.Policy
+	}
+	chunkPoliciesReturns struct {
+		result1 [][]policy_client.Policy
+		result2 error
+	}
+	chunkPoliciesReturnsOnCall map[int]struct {
+		result1 [][]policy_client.Policy
+		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *Chunker) Chunk(arg1 []policy_client.PolicyV0) [][]policy_client.PolicyV0 {
+func (fake *Chunker) Chunk(arg1 []policy_client.PolicyV0) ([][]policy_client.PolicyV0, error) {
 	var arg1Copy []policy_client.PolicyV0
 	if arg1 != nil {
 		arg1Copy = make([]policy_client.PolicyV0, len(arg1))
@@ -42,9 +57,9 @@ func (fake *Chunker) Chunk(arg1 []policy_client.PolicyV0) [][]policy_client.Poli
 		return stub(arg1)
 	}
 	if specificReturn {
-		return ret.result1
+		return ret.result1, ret.result2
 	}
-	return fakeReturns.result1
+	return fakeReturns.result1, fakeReturns.result2
 }
 
 func (fake *Chunker) ChunkCallCount() int {
@@ -53,7 +68,7 @@ func (fake *Chunker) ChunkCallCount() int {
 	return len(fake.chunkArgsForCall)
 }
 
-func (fake *Chunker) ChunkCalls(stub func([]policy_client.PolicyV0) [][]policy_client.PolicyV0) {
+func (fake *Chunker) ChunkCalls(stub func([]policy_client.PolicyV0) ([][]policy_client.PolicyV0, error)) {
 	fake.chunkMutex.Lock()
 	defer fake.chunkMutex.Unlock()
 	fake.ChunkStub = stub
@@ -66,27 +81,99 @@ func (fake *Chunker) ChunkArgsForCall(i int) []policy_client.PolicyV0 {
 	return argsForCall.arg1
 }
 
-func (fake *Chunker) ChunkReturns(result1 [][]policy_client.PolicyV0) {
+func (fake *Chunker) ChunkReturns(result1 [][]policy_client.PolicyV0, result2 error) {
 	fake.chunkMutex.Lock()
 	defer fake.chunkMutex.Unlock()
 	fake.ChunkStub = nil
 	fake.chunkReturns = struct {
 		result1 [][]policy_client.PolicyV0
-	}{result1}
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *Chunker) ChunkReturnsOnCall(i int, result1 [][]policy_client.PolicyV0) {
+func (fake *Chunker) ChunkReturnsOnCall(i int, result1 [][]policy_client.PolicyV0, result2 error) {
 	fake.chunkMutex.Lock()
 	defer fake.chunkMutex.Unlock()
 	fake.ChunkStub = nil
 	if fake.chunkReturnsOnCall == nil {
 		fake.chunkReturnsOnCall = make(map[int]struct {
 			result1 [][]policy_client.PolicyV0
+			result2 error
 		})
 	}
 	fake.chunkReturnsOnCall[i] = struct {
 		result1 [][]policy_client.PolicyV0
-	}{result1}
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *Chunker) ChunkPolicies(arg1 []policy_client.Policy) ([][]policy_client.Policy, error) {
+	var arg1Copy []policy_client.Policy
+	if arg1 != nil {
+		arg1Copy = make([]policy_client.Policy, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.chunkPoliciesMutex.Lock()
+	ret, specificReturn := fake.chunkPoliciesReturnsOnCall[len(fake.chunkPoliciesArgsForCall)]
+	fake.chunkPoliciesArgsForCall = append(fake.chunkPoliciesArgsForCall, struct {
+		arg1 []policy_client.Policy
+	}{arg1Copy})
+	stub := fake.ChunkPoliciesStub
+	fakeReturns := fake.chunkPoliciesReturns
+	fake.recordInvocation("ChunkPolicies", []interface{}{arg1Copy})
+	fake.chunkPoliciesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *Chunker) ChunkPoliciesCallCount() int {
+	fake.chunkPoliciesMutex.RLock()
+	defer fake.chunkPoliciesMutex.RUnlock()
+	return len(fake.chunkPoliciesArgsForCall)
+}
+
+func (fake *Chunker) ChunkPoliciesCalls(stub func([]policy_client.Policy) ([][]policy_client.Policy, error)) {
+	fake.chunkPoliciesMutex.Lock()
+	defer fake.chunkPoliciesMutex.Unlock()
+	fake.ChunkPoliciesStub = stub
+}
+
+func (fake *Chunker) ChunkPoliciesArgsForCall(i int) []policy_client.Policy {
+	fake.chunkPoliciesMutex.RLock()
+	defer fake.chunkPoliciesMutex.RUnlock()
+	argsForCall := fake.chunkPoliciesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *Chunker) ChunkPoliciesReturns(result1 [][]policy_client.Policy, result2 error) {
+	fake.chunkPoliciesMutex.Lock()
+	defer fake.chunkPoliciesMutex.Unlock()
+	fake.ChunkPoliciesStub = nil
+	fake.chunkPoliciesReturns = struct {
+		result1 [][]policy_client.Policy
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *Chunker) ChunkPoliciesReturnsOnCall(i int, result1 [][]policy_client.Policy, result2 error) {
+	fake.chunkPoliciesMutex.Lock()
+	defer fake.chunkPoliciesMutex.Unlock()
+	fake.ChunkPoliciesStub = nil
+	if fake.chunkPoliciesReturnsOnCall == nil {
+		fake.chunkPoliciesReturnsOnCall = make(map[int]struct {
+			result1 [][]policy_client.Policy
+			result2 error
+		})
+	}
+	fake.chunkPoliciesReturnsOnCall[i] = struct {
+		result1 [][]policy_client.Policy
+		result2 error
+	}{result1, result2}
 }
 
 func (fake *Chunker) Invocations() map[string][][]interface{} {
@@ -94,6 +181,8 @@ func (fake *Chunker) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.chunkMutex.RLock()
 	defer fake.chunkMutex.RUnlock()
+	fake.chunkPoliciesMutex.RLock()
+	defer fake.chunkPoliciesMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,195 @@
+package policy_client
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Mutation string
+
+const (
+	MutationAdd    Mutation = "add"
+	MutationDelete Mutation = "delete"
+)
+
+// Change is a mutation a Guardrail checks. V0 policies are converted to
+// v1 policies first.
+type Change struct {
+	Mutation Mutation
+	Policies []Policy
+	// Existing gets the policies on the server involving any of the apps.
+	Existing func(appIDs ...string) ([]Policy, error)
+}
+
+// Guardrail is a rule ExternalClient enforces before a mutation. Check
+// returns a violation for each policy that breaks the rule.
+type Guardrail interface {
+	Name() string
+	Check(change Change) ([]Violation, error)
+}
+
+// Violation is a policy at Index in the change that broke a guardrail.
+type Violation struct {
+	Guardrail string `json:"guardrail"`
+	Index     int    `json:"index"`
+	Policy    Policy `json:"policy"`
+	Message   string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: policy %d from %s to %s %s", v.Guardrail, v.Index, v.Policy.Source.ID, v.Policy.Destination.ID, v.Message)
+}
+
+// GuardrailError is returned instead of mutating when guardrails are
+// violated.
+type GuardrailError struct {
+	Violations []Violation
+}
+
+func (e *GuardrailError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return "guardrails violated: " + strings.Join(messages, "; ")
+}
+
+// CheckGuardrails runs every guardrail against the change and returns a
+// GuardrailError listing all violations, or nil.
+func CheckGuardrails(guardrails []Guardrail, change Change) error {
+	var violations []Violation
+	for _, guardrail := range guardrails {
+		found, err := guardrail.Check(change)
+		if err != nil {
+			return fmt.Errorf("guardrail %s: %w", guardrail.Name(), err)
+		}
+		violations = append(violations, found...)
+	}
+	if len(violations) > 0 {
+		return &GuardrailError{Violations: violations}
+	}
+	return nil
+}
+
+// ProtectedApps forbids adding policies to any of AppIDs, such as system
+// apps.
+type ProtectedApps struct {
+	AppIDs []string
+}
+
+func (g ProtectedApps) Name() string {
+	return "protected_apps"
+}
+
+func (g ProtectedApps) Check(change Change) ([]Violation, error) {
+	return checkEach(g.Name(), change, func(p Policy) string {
+		if slices.Contains(g.AppIDs, p.Destination.ID) {
+			return "targets a protected app"
+		}
+		return ""
+	}), nil
+}
+
+// MaxPortRange limits how many ports an added policy may allow.
+type MaxPortRange struct {
+	Max int
+}
+
+func (g MaxPortRange) Name() string {
+	return "max_port_range"
+}
+
+func (g MaxPortRange) Check(change Change) ([]Violation, error) {
+	return checkEach(g.Name(), change, func(p Policy) string {
+		if width := p.Destination.Ports.End - p.Destination.Ports.Start + 1; width > g.Max {
+			return fmt.Sprintf("allows %d ports, more than %d", width, g.Max)
+		}
+		return ""
+	}), nil
+}
+
+// NoSelfPolicies forbids adding policies from an app to itself.
+type NoSelfPolicies struct{}
+
+func (g NoSelfPolicies) Name() string {
+	return "no_self_policies"
+}
+
+func (g NoSelfPolicies) Check(change Change) ([]Violation, error) {
+	return checkEach(g.Name(), change, func(p Policy) string {
+		if p.Source.ID == p.Destination.ID {
+			return "is a policy from an app to itself"
+		}
+		return ""
+	}), nil
+}
+
+// MaxPoliciesPerSource limits how many policies a source app may have,
+// counting the ones already on the server.
+type MaxPoliciesPerSource struct {
+	Max int
+}
+
+func (g MaxPoliciesPerSource) Name() string {
+	return "max_policies_per_source"
+}
+
+func (g MaxPoliciesPerSource) Check(change Change) ([]Violation, error) {
+	if change.Mutation != MutationAdd || len(change.Policies) == 0 {
+		return nil, nil
+	}
+
+	var sources []string
+	for _, policy := range change.Policies {
+		sources = append(sources, policy.Source.ID)
+	}
+	slices.Sort(sources)
+	sources = slices.Compact(sources)
+	existing, err := change.Existing(sources...)
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := map[string]*PolicySet{}
+	for _, source := range sources {
+		bySource[source] = &PolicySet{}
+	}
+	for _, policy := range existing {
+		if set, ok := bySource[policy.Source.ID]; ok {
+			set.Add(policy)
+		}
+	}
+
+	var violations []Violation
+	for i, policy := range change.Policies {
+		set := bySource[policy.Source.ID]
+		if set.Contains(policy) {
+			continue
+		}
+		set.Add(policy)
+		if set.Len() > g.Max {
+			violations = append(violations, Violation{
+				Guardrail: g.Name(),
+				Index:     i,
+				Policy:    policy,
+				Message:   fmt.Sprintf("gives %s more than %d policies", policy.Source.ID, g.Max),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// checkEach reports the added policies for which check returns a message.
+func checkEach(name string, change Change, check func(Policy) string) []Violation {
+	if change.Mutation != MutationAdd {
+		return nil
+	}
+	var violations []Violation
+	for i, policy := range change.Policies {
+		if message := check(policy); message != "" {
+			violations = append(violations, Violation{Guardrail: name, Index: i, Policy: policy, Message: message})
+		}
+	}
+	return violations
+}
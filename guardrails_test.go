@@ -0,0 +1,162 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Guardrails", func() {
+	var (
+		change   policy_client.Change
+		existing []policy_client.Policy
+	)
+
+	BeforeEach(func() {
+		existing = []policy_client.Policy{
+			testPolicy("app-a", "app-x", 80, 80),
+		}
+		change = policy_client.Change{
+			Mutation: policy_client.MutationAdd,
+			Policies: []policy_client.Policy{
+				testPolicy("app-a", "app-b", 8080, 8080),
+				testPolicy("app-a", "system-app", 8080, 8080),
+				testPolicy("app-b", "app-b", 1, 65535),
+			},
+			Existing: func(appIDs ...string) ([]policy_client.Policy, error) {
+				return existing, nil
+			},
+		}
+	})
+
+	It("reports every violation of every guardrail", func() {
+		err := policy_client.CheckGuardrails([]policy_client.Guardrail{
+			policy_client.ProtectedApps{AppIDs: []string{"system-app"}},
+			policy_client.MaxPortRange{Max: 100},
+			policy_client.NoSelfPolicies{},
+			policy_client.MaxPoliciesPerSource{Max: 2},
+		}, change)
+
+		var guardrailErr *policy_client.GuardrailError
+		Expect(errors.As(err, &guardrailErr)).To(BeTrue())
+		Expect(guardrailErr.Violations).To(Equal([]policy_client.Violation{
+			{Guardrail: "protected_apps", Index: 1, Policy: change.Policies[1], Message: "targets a protected app"},
+			{Guardrail: "max_port_range", Index: 2, Policy: change.Policies[2], Message: "allows 65535 ports, more than 100"},
+			{Guardrail: "no_self_policies", Index: 2, Policy: change.Policies[2], Message: "is a policy from an app to itself"},
+			{Guardrail: "max_policies_per_source", Index: 1, Policy: change.Policies[1], Message: "gives app-a more than 2 policies"},
+		}))
+		Expect(err).To(MatchError(HavePrefix("guardrails violated: protected_apps: policy 1 from app-a to system-app targets a protected app; ")))
+	})
+
+	It("returns nil when nothing is violated", func() {
+		change.Policies = change.Policies[:1]
+		Expect(policy_client.CheckGuardrails([]policy_client.Guardrail{
+			policy_client.ProtectedApps{AppIDs: []string{"system-app"}},
+			policy_client.MaxPortRange{Max: 1},
+			policy_client.NoSelfPolicies{},
+			policy_client.MaxPoliciesPerSource{Max: 2},
+		}, change)).To(Succeed())
+	})
+
+	It("allows deletes", func() {
+		change.Mutation = policy_client.MutationDelete
+		Expect(policy_client.CheckGuardrails([]policy_client.Guardrail{
+			policy_client.ProtectedApps{AppIDs: []string{"system-app"}},
+			policy_client.MaxPortRange{Max: 1},
+			policy_client.NoSelfPolicies{},
+			policy_client.MaxPoliciesPerSource{Max: 0},
+		}, change)).To(Succeed())
+	})
+
+	Describe("MaxPoliciesPerSource", func() {
+		It("does not count policies that already exist", func() {
+			change.Policies = []policy_client.Policy{existing[0], existing[0], testPolicy("app-a", "app-b", 1, 1)}
+			violations, err := policy_client.MaxPoliciesPerSource{Max: 2}.Check(change)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("returns the error getting the existing policies", func() {
+			change.Existing = func(appIDs ...string) ([]policy_client.Policy, error) {
+				return nil, errors.New("banana")
+			}
+			err := policy_client.CheckGuardrails([]policy_client.Guardrail{policy_client.MaxPoliciesPerSource{Max: 2}}, change)
+			Expect(err).To(MatchError("guardrail max_policies_per_source: banana"))
+		})
+	})
+
+	Describe("ExternalClient", func() {
+		var (
+			client     *policy_client.ExternalClient
+			jsonClient *hfakes.JSONClient
+		)
+
+		BeforeEach(func() {
+			jsonClient = &hfakes.JSONClient{}
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				if method != "GET" {
+					return nil
+				}
+				body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": existing})
+				return json.Unmarshal(body, respData)
+			}
+			client = &policy_client.ExternalClient{
+				JsonClient: jsonClient,
+				Chunker:    &policy_client.SimpleChunker{},
+				Guardrails: []policy_client.Guardrail{
+					policy_client.NoSelfPolicies{},
+					policy_client.MaxPoliciesPerSource{Max: 2},
+				},
+			}
+		})
+
+		It("does not post a violating mutation", func() {
+			err := client.AddPolicies("some-token", change.Policies)
+			Expect(err).To(BeAssignableToTypeOf(&policy_client.GuardrailError{}))
+			Expect(jsonClient.DoCallCount()).To(Equal(1))
+			method, route, _, _, _ := jsonClient.DoArgsForCall(0)
+			Expect(method).To(Equal("GET"))
+			Expect(route).To(Equal("/networking/v1/external/policies?id=app-a,app-b"))
+		})
+
+		It("checks v0 mutations", func() {
+			err := client.AddPoliciesV0("some-token", []policy_client.PolicyV0{{
+				Source:      policy_client.SourceV0{ID: "app-c"},
+				Destination: policy_client.DestinationV0{ID: "app-c", Protocol: "tcp", Port: 8080},
+			}})
+			Expect(err).To(MatchError("guardrails violated: no_self_policies: policy 0 from app-c to app-c is a policy from an app to itself"))
+			_, route, _, _, _ := jsonClient.DoArgsForCall(0)
+			Expect(route).To(Equal("/networking/v0/external/policies?id=app-c"))
+			Expect(jsonClient.DoCallCount()).To(Equal(1))
+		})
+
+		Context("when serving v0 from v1", func() {
+			It("checks v0 mutations against the v1 policies, even with port ranges", func() {
+				client.ServeV0FromV1 = true
+				existing = append(existing, testPolicy("app-c", "app-d", 1, 1001))
+
+				err := client.AddPoliciesV0("some-token", []policy_client.PolicyV0{{
+					Source:      policy_client.SourceV0{ID: "app-c"},
+					Destination: policy_client.DestinationV0{ID: "app-e", Protocol: "tcp", Port: 8080},
+				}})
+				Expect(err).NotTo(HaveOccurred())
+				method, route, _, _, _ := jsonClient.DoArgsForCall(0)
+				Expect(method).To(Equal("GET"))
+				Expect(route).To(Equal("/networking/v1/external/policies?id=app-c"))
+				_, route, _, _, _ = jsonClient.DoArgsForCall(1)
+				Expect(route).To(Equal("/networking/v1/external/policies"))
+			})
+		})
+
+		It("posts a mutation within the guardrails", func() {
+			Expect(client.AddPolicies("some-token", change.Policies[:1])).To(Succeed())
+			Expect(client.DeletePolicies("some-token", change.Policies)).To(Succeed())
+			Expect(jsonClient.DoCallCount()).To(Equal(3))
+		})
+	})
+})
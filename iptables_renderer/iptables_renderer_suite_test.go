@@ -0,0 +1,13 @@
+package iptables_renderer_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestIptablesRenderer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IptablesRenderer Suite")
+}
@@ -0,0 +1,321 @@
+package iptables_renderer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/policy_client"
+)
+
+const (
+	DefaultTable  = "filter"
+	DefaultTarget = "ACCEPT"
+
+	// iptables rejects LOG prefixes longer than this
+	maxLogPrefixLength = 29
+	icmpAll            = -1
+
+	// LOG rules only log the first packet of each connection
+	logStates = "-m conntrack --ctstate INVALID,NEW,UNTRACKED"
+)
+
+type Chains struct {
+	// Rules is the chain every ASG rule is appended to.
+	Rules string
+	// Log is optional. When set, Log: true rules jump to it and it is
+	// rendered with a LOG rule followed by the accept target. When empty,
+	// Log: true rules get an inline LOG rule ahead of the accept rule.
+	// Either way only new, invalid and untracked connections are logged.
+	Log string
+}
+
+type Options struct {
+	// Table defaults to DefaultTable.
+	Table string
+	// Target defaults to DefaultTarget.
+	Target string
+	// LogPrefix is passed to --log-prefix for Log: true rules.
+	LogPrefix string
+	// UseIPRange renders start-end destinations with the iprange module
+	// instead of expanding them into CIDRs.
+	UseIPRange bool
+	// IPv6 renders ip6tables-restore input. Destinations of the other
+	// address family are skipped.
+	IPv6 bool
+}
+
+func (o Options) table() string {
+	if o.Table == "" {
+		return DefaultTable
+	}
+	return o.Table
+}
+
+func (o Options) target() string {
+	if o.Target == "" {
+		return DefaultTarget
+	}
+	return o.Target
+}
+
+// Render produces iptables-restore input for the effective security groups
+// of a container. Groups are ordered by GUID and duplicate rules are
+// dropped, so the same set of groups always renders the same output.
+func Render(groups []policy_client.SecurityGroup, chains Chains, opts Options) ([]byte, error) {
+	if chains.Rules == "" {
+		return nil, errors.New("rules chain cannot be empty")
+	}
+	if len(opts.LogPrefix) > maxLogPrefixLength {
+		return nil, fmt.Errorf("log prefix %q is longer than %d characters", opts.LogPrefix, maxLogPrefixLength)
+	}
+
+	sorted := make([]policy_client.SecurityGroup, len(groups))
+	copy(sorted, groups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Guid < sorted[j].Guid
+	})
+
+	// A match is rendered once, where it first appears, and logs when any
+	// rule with that match logs. Otherwise an earlier accept for the same
+	// match would stop the traffic before it reaches the LOG rule.
+	var matches []string
+	logged := map[string]bool{}
+	for _, group := range sorted {
+		for i, rule := range group.Rules {
+			ruleMatches, err := renderMatches(rule, opts)
+			if err != nil {
+				return nil, fmt.Errorf("security group %s rule %d: %s", group.Guid, i, err)
+			}
+			for _, match := range ruleMatches {
+				if _, ok := logged[match]; !ok {
+					matches = append(matches, match)
+					logged[match] = false
+				}
+				if rule.Log {
+					logged[match] = true
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%s\n", opts.table())
+	fmt.Fprintf(&buf, ":%s - [0:0]\n", chains.Rules)
+	if chains.Log != "" {
+		fmt.Fprintf(&buf, ":%s - [0:0]\n", chains.Log)
+	}
+	for _, match := range matches {
+		for _, line := range renderLines(match, logged[match], chains, opts) {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	if chains.Log != "" {
+		fmt.Fprintf(&buf, "-A %s %s -j LOG%s\n", chains.Log, logStates, logPrefixArgs(opts))
+		fmt.Fprintf(&buf, "-A %s -j %s\n", chains.Log, opts.target())
+	}
+	fmt.Fprintln(&buf, "COMMIT")
+
+	return buf.Bytes(), nil
+}
+
+// renderMatches returns the protocol and destination matches of a rule,
+// one per destination.
+func renderMatches(rule policy_client.SecurityGroupRule, opts Options) ([]string, error) {
+	protocolMatch, ok, err := protocolArgs(rule, opts)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	destinationMatches, err := destinationArgs(rule.Destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, destination := range destinationMatches {
+		matches = append(matches, strings.TrimSpace(destination+" "+protocolMatch))
+	}
+	return matches, nil
+}
+
+func renderLines(match string, log bool, chains Chains, opts Options) []string {
+	prefix := fmt.Sprintf("-A %s %s", chains.Rules, match)
+	switch {
+	case !log:
+		return []string{fmt.Sprintf("%s -j %s", prefix, opts.target())}
+	case chains.Log != "":
+		return []string{fmt.Sprintf("%s -g %s", prefix, chains.Log)}
+	default:
+		return []string{
+			fmt.Sprintf("%s %s -j LOG%s", prefix, logStates, logPrefixArgs(opts)),
+			fmt.Sprintf("%s -j %s", prefix, opts.target()),
+		}
+	}
+}
+
+// protocolArgs returns the protocol and port matches for a rule. The bool
+// is false when the rule does not apply to the address family being
+// rendered.
+func protocolArgs(rule policy_client.SecurityGroupRule, opts Options) (string, bool, error) {
+	protocol := strings.ToLower(rule.Protocol)
+	switch protocol {
+	case "all":
+		return "", true, nil
+	case "tcp", "udp":
+		ports, err := portArgs(protocol, rule.Ports)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(fmt.Sprintf("-p %s %s", protocol, ports)), true, nil
+	case "icmp":
+		if opts.IPv6 {
+			return "", false, nil
+		}
+		return fmt.Sprintf("-p icmp -m icmp --icmp-type %s", icmpTypeCode(rule.Type, rule.Code)), true, nil
+	case "icmpv6":
+		if !opts.IPv6 {
+			return "", false, nil
+		}
+		return fmt.Sprintf("-p icmpv6 -m icmp6 --icmpv6-type %s", icmpTypeCode(rule.Type, rule.Code)), true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported protocol %q", rule.Protocol)
+	}
+}
+
+func icmpTypeCode(icmpType, icmpCode int) string {
+	if icmpType == icmpAll {
+		return "any"
+	}
+	if icmpCode == icmpAll {
+		return strconv.Itoa(icmpType)
+	}
+	return fmt.Sprintf("%d/%d", icmpType, icmpCode)
+}
+
+func portArgs(protocol, ports string) (string, error) {
+	ports = strings.TrimSpace(ports)
+	if ports == "" {
+		return "", nil
+	}
+
+	var ranges []string
+	for _, p := range strings.Split(ports, ",") {
+		r, err := portRange(strings.TrimSpace(p))
+		if err != nil {
+			return "", err
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 1 {
+		return fmt.Sprintf("-m %s --dport %s", protocol, ranges[0]), nil
+	}
+	return fmt.Sprintf("-m multiport --dports %s", strings.Join(ranges, ",")), nil
+}
+
+func portRange(ports string) (string, error) {
+	startPort, endPort, isRange := strings.Cut(ports, "-")
+	start, err := parsePort(startPort)
+	if err != nil {
+		return "", err
+	}
+	if !isRange {
+		return strconv.Itoa(start), nil
+	}
+	end, err := parsePort(endPort)
+	if err != nil {
+		return "", err
+	}
+	if start > end {
+		return "", fmt.Errorf("invalid port range %q", ports)
+	}
+	if start == end {
+		return strconv.Itoa(start), nil
+	}
+	return fmt.Sprintf("%d:%d", start, end), nil
+}
+
+func parsePort(port string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return p, nil
+}
+
+func destinationArgs(destinations string, opts Options) ([]string, error) {
+	var args []string
+	for _, destination := range strings.Split(destinations, ",") {
+		destination = strings.TrimSpace(destination)
+		if destination == "" {
+			continue
+		}
+		startIP, endIP, isRange := strings.Cut(destination, "-")
+		if !isRange {
+			prefix, err := parsePrefix(destination)
+			if err != nil {
+				return nil, err
+			}
+			if prefix.Addr().Is6() == opts.IPv6 {
+				args = append(args, "-d "+prefix.String())
+			}
+			continue
+		}
+
+		start, err := netip.ParseAddr(strings.TrimSpace(startIP))
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(endIP))
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		// iptables has no zones
+		start, end = start.WithZone(""), end.WithZone("")
+		if start.Is6() != end.Is6() || end.Less(start) {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		if start.Is6() != opts.IPv6 {
+			continue
+		}
+		if opts.UseIPRange {
+			args = append(args, fmt.Sprintf("-m iprange --dst-range %s-%s", start, end))
+			continue
+		}
+		prefixes, err := policy_client.RangeToPrefixes(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q", destination)
+		}
+		for _, prefix := range prefixes {
+			args = append(args, "-d "+prefix.String())
+		}
+	}
+	return args, nil
+}
+
+func parsePrefix(destination string) (netip.Prefix, error) {
+	if strings.Contains(destination, "/") {
+		prefix, err := netip.ParsePrefix(destination)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid destination %q", destination)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(destination)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid destination %q", destination)
+	}
+	return netip.PrefixFrom(addr.WithZone(""), addr.BitLen()), nil
+}
+
+func logPrefixArgs(opts Options) string {
+	if opts.LogPrefix == "" {
+		return ""
+	}
+	return fmt.Sprintf(" --log-prefix %q", opts.LogPrefix)
+}
@@ -0,0 +1,197 @@
+package iptables_renderer_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/policy_client"
+	"code.cloudfoundry.org/policy_client/iptables_renderer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func expectGolden(actual []byte, name string) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		Expect(os.WriteFile(path, actual, 0644)).To(Succeed())
+	}
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(actual)).To(Equal(string(expected)))
+}
+
+var _ = Describe("Render", func() {
+	var (
+		groups []policy_client.SecurityGroup
+		chains iptables_renderer.Chains
+		opts   iptables_renderer.Options
+	)
+
+	BeforeEach(func() {
+		groups = []policy_client.SecurityGroup{
+			{
+				Guid: "sg-2-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "80,443", Log: true},
+					{Protocol: "udp", Destination: "10.0.12.1", Ports: "53"},
+					{Protocol: "icmp", Destination: "0.0.0.0/0", Type: 8, Code: -1},
+					{Protocol: "icmpv6", Destination: "::/0", Type: -1, Code: -1},
+				},
+			},
+			{
+				Guid: "public-asg-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "all", Destination: "0.0.0.0-9.255.255.255"},
+					{Protocol: "tcp", Destination: "11.0.0.0-11.0.0.6,2001:db8::/32", Ports: "8080-8090"},
+				},
+			},
+			{
+				Guid: "sg-1-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "ICMP", Destination: "192.168.0.0/16", Type: 3, Code: 4},
+					{Protocol: "udp", Destination: "10.0.12.1", Ports: "53"},
+				},
+			},
+		}
+		chains = iptables_renderer.Chains{Rules: "asg-abc"}
+		opts = iptables_renderer.Options{LogPrefix: "OK_abc"}
+	})
+
+	It("renders CIDR-expanded rules with inline LOG rules", func() {
+		out, err := iptables_renderer.Render(groups, chains, opts)
+		Expect(err).NotTo(HaveOccurred())
+		expectGolden(out, "cidr.golden")
+	})
+
+	It("is deterministic regardless of group order", func() {
+		first, err := iptables_renderer.Render(groups, chains, opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		groups[0], groups[2] = groups[2], groups[0]
+		second, err := iptables_renderer.Render(groups, chains, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+	})
+
+	Context("when UseIPRange is set and a log chain is given", func() {
+		BeforeEach(func() {
+			opts.UseIPRange = true
+			chains.Log = "asg-abc-log"
+		})
+
+		It("renders iprange matches and jumps to the log chain", func() {
+			out, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(out, "iprange.golden")
+		})
+	})
+
+	Context("when rendering for IPv6", func() {
+		BeforeEach(func() {
+			opts.IPv6 = true
+			opts.Table = "mangle"
+			opts.Target = "RETURN"
+		})
+
+		It("only renders IPv6 destinations", func() {
+			out, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(out, "ipv6.golden")
+		})
+	})
+
+	Context("when a logging rule has the same match as an earlier rule", func() {
+		BeforeEach(func() {
+			groups = []policy_client.SecurityGroup{
+				{
+					Guid: "a-default-guid",
+					Rules: policy_client.SecurityGroupRules{
+						{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443"},
+						{Protocol: "udp", Destination: "10.0.12.1", Ports: "53"},
+					},
+				},
+				{
+					Guid: "b-logging-guid",
+					Rules: policy_client.SecurityGroupRules{
+						{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443", Log: true},
+					},
+				},
+			}
+		})
+
+		It("logs the match before accepting it", func() {
+			out, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(out, "shared_log.golden")
+		})
+	})
+
+	Context("when a destination has an IPv6 zone", func() {
+		BeforeEach(func() {
+			opts.IPv6 = true
+			groups = []policy_client.SecurityGroup{{
+				Guid: "zoned-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "all", Destination: "fe80::1%eth0-fe80::4,fe80::9%eth0"},
+				},
+			}}
+		})
+
+		It("drops the zone", func() {
+			out, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("*filter\n:asg-abc - [0:0]\n" +
+				"-A asg-abc -d fe80::1/128 -j ACCEPT\n" +
+				"-A asg-abc -d fe80::2/127 -j ACCEPT\n" +
+				"-A asg-abc -d fe80::4/128 -j ACCEPT\n" +
+				"-A asg-abc -d fe80::9/128 -j ACCEPT\n" +
+				"COMMIT\n"))
+
+			opts.UseIPRange = true
+			out, err = iptables_renderer.Render(groups, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(ContainSubstring("-A asg-abc -m iprange --dst-range fe80::1-fe80::4 -j ACCEPT\n"))
+		})
+	})
+
+	Context("when there are no groups", func() {
+		It("renders an empty chain", func() {
+			out, err := iptables_renderer.Render(nil, chains, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("*filter\n:asg-abc - [0:0]\nCOMMIT\n"))
+		})
+	})
+
+	Context("when the rules chain is empty", func() {
+		It("returns an error", func() {
+			_, err := iptables_renderer.Render(groups, iptables_renderer.Chains{}, opts)
+			Expect(err).To(MatchError("rules chain cannot be empty"))
+		})
+	})
+
+	Context("when the log prefix is too long", func() {
+		It("returns an error", func() {
+			opts.LogPrefix = "a-log-prefix-that-is-far-too-long"
+			_, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).To(MatchError(`log prefix "a-log-prefix-that-is-far-too-long" is longer than 29 characters`))
+		})
+	})
+
+	DescribeTable("invalid rules",
+		func(rule policy_client.SecurityGroupRule, expectedErr string) {
+			groups = []policy_client.SecurityGroup{{Guid: "bad-guid", Rules: policy_client.SecurityGroupRules{rule}}}
+			_, err := iptables_renderer.Render(groups, chains, opts)
+			Expect(err).To(MatchError("security group bad-guid rule 0: " + expectedErr))
+		},
+		Entry("unknown protocol", policy_client.SecurityGroupRule{Protocol: "sctp", Destination: "10.0.0.1"}, `unsupported protocol "sctp"`),
+		Entry("bad port", policy_client.SecurityGroupRule{Protocol: "tcp", Destination: "10.0.0.1", Ports: "http"}, `invalid port "http"`),
+		Entry("reversed port range", policy_client.SecurityGroupRule{Protocol: "tcp", Destination: "10.0.0.1", Ports: "90-80"}, `invalid port range "90-80"`),
+		Entry("bad destination", policy_client.SecurityGroupRule{Protocol: "all", Destination: "10.0.0"}, `invalid destination "10.0.0"`),
+		Entry("reversed ip range", policy_client.SecurityGroupRule{Protocol: "all", Destination: "10.0.0.9-10.0.0.1"}, `invalid destination "10.0.0.9-10.0.0.1"`),
+		Entry("mixed family ip range", policy_client.SecurityGroupRule{Protocol: "all", Destination: "10.0.0.1-::1"}, `invalid destination "10.0.0.1-::1"`),
+	)
+})
@@ -0,0 +1,102 @@
+package policy_client
+
+import "slices"
+
+// MutationPlan is what a mutation would do against the current server
+// state.
+type MutationPlan[T Policy | PolicyV0] struct {
+	// Changes are the policies the call would add, or delete.
+	Changes []T `json:"changes"`
+	// Unchanged are the policies an add would skip because they exist, or
+	// a delete would skip because they do not.
+	Unchanged []T `json:"unchanged"`
+}
+
+// MutationOption configures AddPolicies and DeletePolicies.
+type MutationOption func(*mutationOptions[Policy])
+
+// MutationOptionV0 configures AddPoliciesV0 and DeletePoliciesV0.
+type MutationOptionV0 func(*mutationOptions[PolicyV0])
+
+type mutationOptions[T Policy | PolicyV0] struct {
+	dryRun *MutationPlan[T]
+}
+
+// DryRun makes a mutation fill in plan instead of posting anything.
+func DryRun(plan *MutationPlan[Policy]) MutationOption {
+	return func(o *mutationOptions[Policy]) {
+		o.dryRun = plan
+	}
+}
+
+// DryRunV0 is DryRun for the V0 mutations.
+func DryRunV0(plan *MutationPlan[PolicyV0]) MutationOptionV0 {
+	return func(o *mutationOptions[PolicyV0]) {
+		o.dryRun = plan
+	}
+}
+
+func newMutationOptions[T Policy | PolicyV0, O ~func(*mutationOptions[T])](opts []O) mutationOptions[T] {
+	var o mutationOptions[T]
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// planMutation fills in dryRun when it is set, and reports whether the
+// mutation is a dry run.
+func planMutation[T Policy | PolicyV0](dryRun *MutationPlan[T], adding bool, policies []T, getKeysByID func(ids ...string) ([]PolicyKey, error), key func(T) PolicyKey) (bool, error) {
+	if dryRun == nil {
+		return false, nil
+	}
+	planned, err := newMutationPlan(adding, policies, getKeysByID, key)
+	if err != nil {
+		return true, err
+	}
+	*dryRun = planned
+	return true, nil
+}
+
+// maxIDsPerGet keeps the query string of a get by app IDs well within the
+// request line limits of common proxies.
+const maxIDsPerGet = DefaultMaxPolicies
+
+// newMutationPlan gets the keys of the current policies of the apps in
+// policies, at most maxIDsPerGet apps at a time, to find which ones the
+// mutation would change.
+func newMutationPlan[T Policy | PolicyV0](adding bool, policies []T, getKeysByID func(ids ...string) ([]PolicyKey, error), key func(T) PolicyKey) (MutationPlan[T], error) {
+	ids := []string{}
+	for _, policy := range policies {
+		k := key(policy)
+		ids = append(ids, k.SourceID, k.DestinationID)
+	}
+	slices.Sort(ids)
+
+	current := map[PolicyKey]bool{}
+	for _, batch := range chunk(slices.Compact(ids), maxIDsPerGet) {
+		existing, err := getKeysByID(batch...)
+		if err != nil {
+			return MutationPlan[T]{}, err
+		}
+		for _, k := range existing {
+			current[k] = true
+		}
+	}
+
+	plan := MutationPlan[T]{Changes: []T{}, Unchanged: []T{}}
+	planned := map[PolicyKey]bool{}
+	for _, policy := range policies {
+		k := key(policy)
+		if planned[k] {
+			continue
+		}
+		planned[k] = true
+		if current[k] == adding {
+			plan.Unchanged = append(plan.Unchanged, policy)
+		} else {
+			plan.Changes = append(plan.Changes, policy)
+		}
+	}
+	return plan, nil
+}
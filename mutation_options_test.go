@@ -0,0 +1,135 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DryRun", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		current    []policy_client.Policy
+		policies   []policy_client.Policy
+	)
+
+	BeforeEach(func() {
+		current = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8080),
+		}
+		current[0].Source.Tag = "0001"
+		policies = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8080),
+			testPolicy("app-a", "app-c", 443, 443),
+			testPolicy("app-a", "app-c", 443, 443),
+		}
+
+		jsonClient = &hfakes.JSONClient{}
+		jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+			var body []byte
+			if route == "/networking/v0/external/policies?id=app-a,app-b,app-c" {
+				body, _ = json.Marshal(map[string][]policy_client.PolicyV0{"policies": {
+					{
+						Source:      policy_client.SourceV0{ID: "app-a", Tag: "0001"},
+						Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8080},
+					},
+				}})
+			} else {
+				body, _ = json.Marshal(map[string][]policy_client.Policy{"policies": current})
+			}
+			return json.Unmarshal(body, respData)
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+			Chunker:    &policy_client.SimpleChunker{},
+		}
+	})
+
+	It("plans an add without posting", func() {
+		var plan policy_client.MutationPlan[policy_client.Policy]
+		err := client.AddPolicies("some-token", policies, policy_client.DryRun(&plan))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(plan.Changes).To(Equal([]policy_client.Policy{policies[1]}))
+		Expect(plan.Unchanged).To(Equal([]policy_client.Policy{policies[0]}))
+
+		Expect(jsonClient.DoCallCount()).To(Equal(1))
+		method, route, _, _, token := jsonClient.DoArgsForCall(0)
+		Expect(method).To(Equal("GET"))
+		Expect(route).To(Equal("/networking/v1/external/policies?id=app-a,app-b,app-c"))
+		Expect(token).To(Equal("some-token"))
+	})
+
+	It("plans a delete without posting", func() {
+		var plan policy_client.MutationPlan[policy_client.Policy]
+		err := client.DeletePolicies("some-token", policies, policy_client.DryRun(&plan))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(plan.Changes).To(Equal([]policy_client.Policy{policies[0]}))
+		Expect(plan.Unchanged).To(Equal([]policy_client.Policy{policies[1]}))
+		Expect(jsonClient.DoCallCount()).To(Equal(1))
+	})
+
+	It("plans v0 mutations", func() {
+		policiesV0 := []policy_client.PolicyV0{
+			{
+				Source:      policy_client.SourceV0{ID: "app-a"},
+				Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8080},
+			},
+			{
+				Source:      policy_client.SourceV0{ID: "app-a"},
+				Destination: policy_client.DestinationV0{ID: "app-c", Protocol: "tcp", Port: 443},
+			},
+		}
+		var plan policy_client.MutationPlan[policy_client.PolicyV0]
+		err := client.AddPoliciesV0("some-token", policiesV0, policy_client.DryRunV0(&plan))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Changes).To(Equal(policiesV0[1:]))
+		Expect(plan.Unchanged).To(Equal(policiesV0[:1]))
+
+		err = client.DeletePoliciesV0("some-token", policiesV0, policy_client.DryRunV0(&plan))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Changes).To(Equal(policiesV0[:1]))
+		Expect(plan.Unchanged).To(Equal(policiesV0[1:]))
+		Expect(jsonClient.DoCallCount()).To(Equal(2))
+	})
+
+	Context("when serving v0 from v1", func() {
+		It("plans against the v1 policies, even with port ranges", func() {
+			client.ServeV0FromV1 = true
+			current = append(current, testPolicy("app-a", "app-c", 1, 1001))
+			policiesV0 := []policy_client.PolicyV0{
+				{
+					Source:      policy_client.SourceV0{ID: "app-a"},
+					Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8080},
+				},
+				{
+					Source:      policy_client.SourceV0{ID: "app-a"},
+					Destination: policy_client.DestinationV0{ID: "app-c", Protocol: "tcp", Port: 443},
+				},
+			}
+
+			var plan policy_client.MutationPlan[policy_client.PolicyV0]
+			err := client.AddPoliciesV0("some-token", policiesV0, policy_client.DryRunV0(&plan))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Changes).To(Equal(policiesV0[1:]))
+			Expect(plan.Unchanged).To(Equal(policiesV0[:1]))
+
+			Expect(jsonClient.DoCallCount()).To(Equal(1))
+			_, route, _, _, _ := jsonClient.DoArgsForCall(0)
+			Expect(route).To(Equal("/networking/v1/external/policies?id=app-a,app-b,app-c"))
+		})
+	})
+
+	It("does not get anything for no policies", func() {
+		var plan policy_client.MutationPlan[policy_client.Policy]
+		Expect(client.AddPolicies("some-token", nil, policy_client.DryRun(&plan))).To(Succeed())
+		Expect(plan.Changes).To(BeEmpty())
+		Expect(jsonClient.DoCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,97 @@
+package policy_client
+
+import "sort"
+
+type policyGroupKey struct {
+	sourceID      string
+	destinationID string
+	protocol      string
+}
+
+func groupKey(p Policy) policyGroupKey {
+	return policyGroupKey{
+		sourceID:      p.Source.ID,
+		destinationID: p.Destination.ID,
+		protocol:      p.Destination.Protocol,
+	}
+}
+
+// Coalesce returns the smallest set of policies that allows the same
+// traffic. Policies with the same source, destination and protocol whose
+// port ranges overlap or are adjacent are merged into one, so 8080-8090
+// and 8085-8100 become 8080-8100. Merged policies keep the tags of the
+// first policy for that source, destination and protocol. The result is
+// in PolicySlice order.
+func Coalesce(policies []Policy) []Policy {
+	groups := map[policyGroupKey][]Policy{}
+	for _, p := range policies {
+		key := groupKey(p)
+		groups[key] = append(groups[key], p)
+	}
+
+	var result []Policy
+	for _, group := range groups {
+		template := group[0]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Destination.Ports.Start < group[j].Destination.Ports.Start
+		})
+
+		var merged []Ports
+		for _, p := range group {
+			ports := p.Destination.Ports
+			if len(merged) > 0 {
+				last := &merged[len(merged)-1]
+				if ports.Start <= last.End+1 {
+					if ports.End > last.End {
+						last.End = ports.End
+					}
+					continue
+				}
+			}
+			merged = append(merged, ports)
+		}
+
+		for _, ports := range merged {
+			p := template
+			p.Destination.Ports = ports
+			result = append(result, p)
+		}
+	}
+
+	sort.Sort(PolicySlice(result))
+	return result
+}
+
+// RedundantPolicies returns, in input order, the policies whose port range
+// is within the range of another single policy with the same source,
+// destination and protocol. Of identical policies all but the first are
+// returned. Every returned policy can be removed with DeletePolicies
+// without changing the allowed traffic, because each one is covered by a
+// policy that is not returned.
+func RedundantPolicies(policies []Policy) []Policy {
+	byGroup := map[policyGroupKey][]int{}
+	for i, p := range policies {
+		key := groupKey(p)
+		byGroup[key] = append(byGroup[key], i)
+	}
+
+	var redundant []Policy
+	for i, p := range policies {
+		ports := p.Destination.Ports
+		for _, j := range byGroup[groupKey(p)] {
+			if i == j {
+				continue
+			}
+			other := policies[j].Destination.Ports
+			if other.Start > ports.Start || other.End < ports.End {
+				continue
+			}
+			if other == ports && j > i {
+				continue
+			}
+			redundant = append(redundant, p)
+			break
+		}
+	}
+	return redundant
+}
@@ -0,0 +1,71 @@
+package policy_client_test
+
+import (
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy coalescing", func() {
+	var policies []policy_client.Policy
+
+	BeforeEach(func() {
+		policies = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8085, 8100),
+			testPolicy("app-a", "app-b", 8080, 8090),
+			testPolicy("app-a", "app-b", 8095, 8095),
+			testPolicy("app-a", "app-b", 8101, 8105),
+			testPolicy("app-a", "app-b", 9000, 9000),
+			testPolicy("app-a", "app-c", 8080, 8080),
+			testPolicy("app-a", "app-c", 8080, 8080),
+		}
+		policies[0].Source.Tag = "0001"
+		udp := testPolicy("app-a", "app-b", 8080, 8080)
+		udp.Destination.Protocol = "udp"
+		policies = append(policies, udp)
+	})
+
+	Describe("Coalesce", func() {
+		It("merges overlapping and adjacent ranges", func() {
+			tagged := func(p policy_client.Policy) policy_client.Policy {
+				p.Source.Tag = "0001"
+				return p
+			}
+			Expect(policy_client.Coalesce(policies)).To(Equal([]policy_client.Policy{
+				tagged(testPolicy("app-a", "app-b", 8080, 8105)),
+				tagged(testPolicy("app-a", "app-b", 9000, 9000)),
+				policies[7],
+				policies[5],
+			}))
+		})
+
+		It("does not modify the input", func() {
+			policy_client.Coalesce(policies)
+			Expect(policies[0].Destination.Ports).To(Equal(policy_client.Ports{Start: 8085, End: 8100}))
+			Expect(policies[1].Destination.Ports).To(Equal(policy_client.Ports{Start: 8080, End: 8090}))
+		})
+
+		It("returns nothing for no policies", func() {
+			Expect(policy_client.Coalesce(nil)).To(BeEmpty())
+		})
+	})
+
+	Describe("RedundantPolicies", func() {
+		It("lists policies covered by another policy and later duplicates", func() {
+			Expect(policy_client.RedundantPolicies(policies)).To(Equal([]policy_client.Policy{
+				policies[2],
+				policies[6],
+			}))
+		})
+
+		It("does not list policies only covered by several others", func() {
+			covered := []policy_client.Policy{
+				testPolicy("app-a", "app-b", 8080, 8085),
+				testPolicy("app-a", "app-b", 8080, 8082),
+				testPolicy("app-a", "app-b", 8083, 8090),
+			}
+			Expect(policy_client.RedundantPolicies(covered)).To(Equal([]policy_client.Policy{covered[1]}))
+		})
+	})
+})
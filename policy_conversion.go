@@ -0,0 +1,143 @@
+package policy_client
+
+import "fmt"
+
+const DefaultMaxV0Expansion = 100
+
+// V0ConversionError is returned when a port range expands to more v0
+// policies than the converter allows.
+type V0ConversionError struct {
+	Ports Ports
+	Limit int
+}
+
+func (e *V0ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert ports %d-%d to v0: expands to %d policies, limit is %d",
+		e.Ports.Start, e.Ports.End, e.Ports.End-e.Ports.Start+1, e.Limit)
+}
+
+// V0Converter converts v1 policies to v0 policies, which have a single
+// port, by expanding port ranges into one policy per port.
+type V0Converter struct {
+	// MaxExpansion is the most v0 policies a single port range may expand
+	// to. DefaultMaxV0Expansion is used when it is zero or less.
+	MaxExpansion int
+}
+
+func (c V0Converter) getMaxExpansion() int {
+	if c.MaxExpansion <= 0 {
+		return DefaultMaxV0Expansion
+	}
+	return c.MaxExpansion
+}
+
+func (c V0Converter) ToV0(policy Policy) ([]PolicyV0, error) {
+	destinations, err := c.DestinationToV0(policy.Destination)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]PolicyV0, len(destinations))
+	for i, destination := range destinations {
+		policies[i] = PolicyV0{
+			Source:      SourceToV0(policy.Source),
+			Destination: destination,
+		}
+	}
+	return policies, nil
+}
+
+func (c V0Converter) PoliciesToV0(policies []Policy) ([]PolicyV0, error) {
+	var result []PolicyV0
+	for i, policy := range policies {
+		converted, err := c.ToV0(policy)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+		result = append(result, converted...)
+	}
+	return result, nil
+}
+
+func (c V0Converter) DestinationToV0(destination Destination) ([]DestinationV0, error) {
+	ports := destination.Ports
+	if ports.Start > ports.End {
+		return nil, fmt.Errorf("invalid port range %d-%d", ports.Start, ports.End)
+	}
+	if limit := c.getMaxExpansion(); ports.End-ports.Start+1 > limit {
+		return nil, &V0ConversionError{Ports: ports, Limit: limit}
+	}
+
+	destinations := make([]DestinationV0, 0, ports.End-ports.Start+1)
+	for port := ports.Start; port <= ports.End; port++ {
+		destinations = append(destinations, DestinationV0{
+			ID:       destination.ID,
+			Tag:      destination.Tag,
+			Protocol: destination.Protocol,
+			Port:     port,
+		})
+	}
+	return destinations, nil
+}
+
+// ToV0 converts a policy with the default V0Converter.
+func ToV0(policy Policy) ([]PolicyV0, error) {
+	return V0Converter{}.ToV0(policy)
+}
+
+// PoliciesToV0 converts policies with the default V0Converter.
+func PoliciesToV0(policies []Policy) ([]PolicyV0, error) {
+	return V0Converter{}.PoliciesToV0(policies)
+}
+
+// DestinationToV0 converts a destination with the default V0Converter.
+func DestinationToV0(destination Destination) ([]DestinationV0, error) {
+	return V0Converter{}.DestinationToV0(destination)
+}
+
+func ToV1(policy PolicyV0) Policy {
+	return Policy{
+		Source:      SourceToV1(policy.Source),
+		Destination: DestinationToV1(policy.Destination),
+	}
+}
+
+func PoliciesToV1(policies []PolicyV0) []Policy {
+	result := make([]Policy, len(policies))
+	for i, policy := range policies {
+		result[i] = ToV1(policy)
+	}
+	return result
+}
+
+func SourceToV0(source Source) SourceV0 {
+	return SourceV0{ID: source.ID, Tag: source.Tag}
+}
+
+func SourceToV1(source SourceV0) Source {
+	return Source{ID: source.ID, Tag: source.Tag}
+}
+
+func DestinationToV1(destination DestinationV0) Destination {
+	return Destination{
+		ID:       destination.ID,
+		Tag:      destination.Tag,
+		Protocol: destination.Protocol,
+		Ports:    Ports{Start: destination.Port, End: destination.Port},
+	}
+}
+
+func TagToV0(tag Tag) TagV0 {
+	return TagV0{ID: tag.ID, Tag: tag.Tag}
+}
+
+func TagToV1(tag TagV0) Tag {
+	return Tag{ID: tag.ID, Tag: tag.Tag}
+}
+
+func SpaceToV0(space Space) SpaceV0 {
+	return SpaceV0{Name: space.Name, OrgGUID: space.OrgGUID}
+}
+
+func SpaceToV1(space SpaceV0) Space {
+	return Space{Name: space.Name, OrgGUID: space.OrgGUID}
+}
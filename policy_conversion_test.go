@@ -0,0 +1,137 @@
+package policy_client_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy conversion", func() {
+	var (
+		policy   policy_client.Policy
+		policyV0 policy_client.PolicyV0
+	)
+
+	BeforeEach(func() {
+		policy = policy_client.Policy{
+			Source: policy_client.Source{ID: "some-app-guid", Tag: "0001"},
+			Destination: policy_client.Destination{
+				ID:       "some-other-app-guid",
+				Tag:      "0002",
+				Protocol: "tcp",
+				Ports:    policy_client.Ports{Start: 8090, End: 8092},
+			},
+		}
+		policyV0 = policy_client.PolicyV0{
+			Source: policy_client.SourceV0{ID: "some-app-guid", Tag: "0001"},
+			Destination: policy_client.DestinationV0{
+				ID:       "some-other-app-guid",
+				Tag:      "0002",
+				Protocol: "tcp",
+				Port:     8090,
+			},
+		}
+	})
+
+	Describe("ToV1", func() {
+		It("converts the port to a single port range", func() {
+			converted := policy_client.ToV1(policyV0)
+			policy.Destination.Ports.End = 8090
+			Expect(converted).To(Equal(policy))
+		})
+	})
+
+	Describe("ToV0", func() {
+		It("expands the port range", func() {
+			converted, err := policy_client.ToV0(policy)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(converted).To(HaveLen(3))
+			Expect(converted[0]).To(Equal(policyV0))
+			Expect(converted[1].Destination.Port).To(Equal(8091))
+			Expect(converted[2].Destination.Port).To(Equal(8092))
+		})
+
+		It("round trips single port policies", func() {
+			converted, err := policy_client.ToV0(policy_client.ToV1(policyV0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(converted).To(Equal([]policy_client.PolicyV0{policyV0}))
+		})
+
+		Context("when the range is larger than the default limit", func() {
+			It("returns a V0ConversionError", func() {
+				policy.Destination.Ports = policy_client.Ports{Start: 1000, End: 1100}
+				_, err := policy_client.ToV0(policy)
+				Expect(err).To(MatchError("cannot convert ports 1000-1100 to v0: expands to 101 policies, limit is 100"))
+
+				var conversionErr *policy_client.V0ConversionError
+				Expect(errors.As(err, &conversionErr)).To(BeTrue())
+				Expect(conversionErr.Limit).To(Equal(policy_client.DefaultMaxV0Expansion))
+			})
+		})
+
+		Context("when the range is reversed", func() {
+			It("returns an error", func() {
+				policy.Destination.Ports = policy_client.Ports{Start: 9000, End: 8000}
+				_, err := policy_client.ToV0(policy)
+				Expect(err).To(MatchError("invalid port range 9000-8000"))
+			})
+		})
+	})
+
+	Describe("V0Converter", func() {
+		It("uses the configured limit", func() {
+			converter := policy_client.V0Converter{MaxExpansion: 2}
+			_, err := converter.ToV0(policy)
+			Expect(err).To(MatchError("cannot convert ports 8090-8092 to v0: expands to 3 policies, limit is 2"))
+
+			converter.MaxExpansion = 3
+			converted, err := converter.ToV0(policy)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(converted).To(HaveLen(3))
+		})
+	})
+
+	Describe("batch conversion", func() {
+		It("converts every policy to v1", func() {
+			other := policyV0
+			other.Destination.Port = 9000
+			Expect(policy_client.PoliciesToV1([]policy_client.PolicyV0{policyV0, other})).To(HaveLen(2))
+		})
+
+		It("converts every policy to v0", func() {
+			single := policy
+			single.Destination.Ports = policy_client.Ports{Start: 443, End: 443}
+			converted, err := policy_client.PoliciesToV0([]policy_client.Policy{policy, single})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(converted).To(HaveLen(4))
+			Expect(converted[3].Destination.Port).To(Equal(443))
+		})
+
+		It("reports the index of a policy that cannot be converted", func() {
+			wide := policy
+			wide.Destination.Ports = policy_client.Ports{Start: 1, End: 65535}
+			_, err := policy_client.PoliciesToV0([]policy_client.Policy{policy, wide})
+			Expect(err).To(MatchError("policy 1: cannot convert ports 1-65535 to v0: expands to 65535 policies, limit is 100"))
+		})
+	})
+
+	Describe("component conversion", func() {
+		It("converts sources, destinations, tags and spaces", func() {
+			Expect(policy_client.SourceToV1(policyV0.Source)).To(Equal(policy.Source))
+			Expect(policy_client.SourceToV0(policy.Source)).To(Equal(policyV0.Source))
+			Expect(policy_client.DestinationToV1(policyV0.Destination).Ports).To(Equal(policy_client.Ports{Start: 8090, End: 8090}))
+
+			destinations, err := policy_client.DestinationToV0(policy.Destination)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(destinations).To(HaveLen(3))
+
+			Expect(policy_client.TagToV1(policy_client.TagV0{ID: "a", Tag: "0001"})).To(Equal(policy_client.Tag{ID: "a", Tag: "0001"}))
+			Expect(policy_client.TagToV0(policy_client.Tag{ID: "a", Tag: "0001"})).To(Equal(policy_client.TagV0{ID: "a", Tag: "0001"}))
+			Expect(policy_client.SpaceToV1(policy_client.SpaceV0{Name: "s", OrgGUID: "o"})).To(Equal(policy_client.Space{Name: "s", OrgGUID: "o"}))
+			Expect(policy_client.SpaceToV0(policy_client.Space{Name: "s", OrgGUID: "o"})).To(Equal(policy_client.SpaceV0{Name: "s", OrgGUID: "o"}))
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package policy_client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// PoliciesFingerprint returns the hex encoded SHA-256 of the policies in
+// PolicySlice order, so the same policies give the same fingerprint in any
+// order. Tags are included.
+func PoliciesFingerprint(policies []Policy) string {
+	sorted := make([]Policy, len(policies))
+	copy(sorted, policies)
+	sort.Sort(PolicySlice(sorted))
+	return fingerprint(sorted)
+}
+
+// PoliciesV0Fingerprint is PoliciesFingerprint for v0 policies.
+func PoliciesV0Fingerprint(policies []PolicyV0) string {
+	sorted := make([]PolicyV0, len(policies))
+	copy(sorted, policies)
+	sort.Sort(PolicyV0Slice(sorted))
+	return fingerprint(sorted)
+}
+
+func fingerprint(v interface{}) string {
+	h := sha256.New()
+	// policies and security groups only contain strings, ints and bools,
+	// which always encode
+	_ = json.NewEncoder(h).Encode(v)
+	return hex.EncodeToString(h.Sum(nil))
+}
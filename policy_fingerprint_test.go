@@ -0,0 +1,60 @@
+package policy_client_test
+
+import (
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy fingerprints", func() {
+	Describe("PoliciesFingerprint", func() {
+		var policies []policy_client.Policy
+
+		BeforeEach(func() {
+			policies = []policy_client.Policy{
+				testPolicy("app-a", "app-b", 8080, 8080),
+				testPolicy("app-a", "app-c", 8080, 8090),
+				testPolicy("app-b", "app-c", 443, 443),
+			}
+		})
+
+		It("is a hex encoded sha256", func() {
+			Expect(policy_client.PoliciesFingerprint(policies)).To(MatchRegexp("^[0-9a-f]{64}$"))
+		})
+
+		It("does not depend on the order of the policies", func() {
+			reordered := []policy_client.Policy{policies[2], policies[0], policies[1]}
+			Expect(policy_client.PoliciesFingerprint(reordered)).To(Equal(policy_client.PoliciesFingerprint(policies)))
+			Expect(reordered[0]).To(Equal(policies[2]))
+		})
+
+		It("changes when the content changes", func() {
+			before := policy_client.PoliciesFingerprint(policies)
+			policies[1].Destination.Ports.End = 8091
+			Expect(policy_client.PoliciesFingerprint(policies)).NotTo(Equal(before))
+		})
+
+		It("includes tags", func() {
+			before := policy_client.PoliciesFingerprint(policies)
+			policies[0].Source.Tag = "0001"
+			Expect(policy_client.PoliciesFingerprint(policies)).NotTo(Equal(before))
+		})
+
+		It("treats nil and empty lists the same", func() {
+			Expect(policy_client.PoliciesFingerprint(nil)).To(Equal(policy_client.PoliciesFingerprint([]policy_client.Policy{})))
+		})
+	})
+
+	Describe("PoliciesV0Fingerprint", func() {
+		It("does not depend on the order of the policies", func() {
+			policies := []policy_client.PolicyV0{
+				{Source: policy_client.SourceV0{ID: "app-a"}, Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8080}},
+				{Source: policy_client.SourceV0{ID: "app-a"}, Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8081}},
+			}
+			reordered := []policy_client.PolicyV0{policies[1], policies[0]}
+			Expect(policy_client.PoliciesV0Fingerprint(reordered)).To(Equal(policy_client.PoliciesV0Fingerprint(policies)))
+			Expect(policy_client.PoliciesV0Fingerprint(policies[:1])).NotTo(Equal(policy_client.PoliciesV0Fingerprint(policies)))
+		})
+	})
+})
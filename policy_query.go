@@ -0,0 +1,147 @@
+package policy_client
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PolicyQuery builds a filtered GET of the external policies. Filters on
+// apps are sent to the policy server; every filter is also applied to the
+// response, so servers that ignore one still give the right result. Each
+// method returns a new query and different filters must all match.
+//
+//	q := NewPolicyQuery().SourceIDs("app-a").Protocol("tcp").Port(8080)
+type PolicyQuery struct {
+	ids            []string
+	sourceIDs      []string
+	destinationIDs []string
+	protocol       string
+	port           int
+}
+
+func NewPolicyQuery() PolicyQuery {
+	return PolicyQuery{}
+}
+
+// IDs matches policies with any of the apps as source or destination.
+func (q PolicyQuery) IDs(ids ...string) PolicyQuery {
+	q.ids = slices.Concat(q.ids, ids)
+	return q
+}
+
+// SourceIDs matches policies from any of the apps.
+func (q PolicyQuery) SourceIDs(ids ...string) PolicyQuery {
+	q.sourceIDs = slices.Concat(q.sourceIDs, ids)
+	return q
+}
+
+// DestinationIDs matches policies to any of the apps.
+func (q PolicyQuery) DestinationIDs(ids ...string) PolicyQuery {
+	q.destinationIDs = slices.Concat(q.destinationIDs, ids)
+	return q
+}
+
+func (q PolicyQuery) Protocol(protocol string) PolicyQuery {
+	q.protocol = protocol
+	return q
+}
+
+// Port matches policies whose port range includes port.
+func (q PolicyQuery) Port(port int) PolicyQuery {
+	q.port = port
+	return q
+}
+
+func (q PolicyQuery) Matches(p Policy) bool {
+	if len(q.ids) > 0 && !slices.Contains(q.ids, p.Source.ID) && !slices.Contains(q.ids, p.Destination.ID) {
+		return false
+	}
+	if len(q.sourceIDs) > 0 && !slices.Contains(q.sourceIDs, p.Source.ID) {
+		return false
+	}
+	if len(q.destinationIDs) > 0 && !slices.Contains(q.destinationIDs, p.Destination.ID) {
+		return false
+	}
+	if q.protocol != "" && q.protocol != p.Destination.Protocol {
+		return false
+	}
+	if q.port != 0 && (q.port < p.Destination.Ports.Start || q.port > p.Destination.Ports.End) {
+		return false
+	}
+	return true
+}
+
+// route returns the v1 route with the filters the policy server supports.
+func (q PolicyQuery) route() string {
+	var params []string
+	for _, param := range []struct {
+		name string
+		ids  []string
+	}{
+		{"id", q.ids},
+		{"source_id", q.sourceIDs},
+		{"dest_id", q.destinationIDs},
+	} {
+		if len(param.ids) == 0 {
+			continue
+		}
+		escaped := make([]string, len(param.ids))
+		for i, id := range param.ids {
+			escaped[i] = url.QueryEscape(id)
+		}
+		params = append(params, param.name+"="+strings.Join(escaped, ","))
+	}
+
+	route := "/networking/v1/external/policies"
+	if len(params) > 0 {
+		route += "?" + strings.Join(params, "&")
+	}
+	return route
+}
+
+// QueryPolicies gets the matching policies. When only v0 is negotiated
+// the v0 route is filtered by id, the only filter it supports.
+func (c *ExternalClient) QueryPolicies(token string, q PolicyQuery) ([]Policy, error) {
+	policies, err := c.queryPolicies(token, q)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Policy{}
+	for _, policy := range policies {
+		if q.Matches(policy) {
+			matching = append(matching, policy)
+		}
+	}
+	return matching, nil
+}
+
+func (c *ExternalClient) queryPolicies(token string, q PolicyQuery) ([]Policy, error) {
+	fromV0, err := c.serveV1FromV0(token)
+	if err != nil {
+		return nil, err
+	}
+	if fromV0 {
+		ids := q.ids
+		if len(ids) == 0 {
+			ids = slices.Concat(q.sourceIDs, q.destinationIDs)
+		}
+		var policies []PolicyV0
+		if len(ids) > 0 {
+			policies, err = c.GetPoliciesV0ByID(token, ids...)
+		} else {
+			policies, err = c.GetPoliciesV0(token)
+		}
+		return PoliciesToV1(policies), err
+	}
+
+	var policies struct {
+		Policies []Policy `json:"policies"`
+	}
+	err = c.JsonClient.Do("GET", q.route(), nil, &policies, token)
+	if err != nil {
+		return nil, parseHttpError(err)
+	}
+	return policies.Policies, nil
+}
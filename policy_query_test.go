@@ -0,0 +1,121 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/json_client"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QueryPolicies", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		current    []policy_client.Policy
+	)
+
+	BeforeEach(func() {
+		current = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8090),
+			testPolicy("app-a", "app-c", 9000, 9000),
+			testPolicy("app-c", "app-a", 8080, 8080),
+		}
+		current[2].Destination.Protocol = "udp"
+
+		jsonClient = &hfakes.JSONClient{}
+		jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+			body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": current})
+			return json.Unmarshal(body, respData)
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+		}
+	})
+
+	It("gets every policy for an empty query", func() {
+		policies, err := client.QueryPolicies("some-token", policy_client.NewPolicyQuery())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal(current))
+
+		method, route, _, _, token := jsonClient.DoArgsForCall(0)
+		Expect(method).To(Equal("GET"))
+		Expect(route).To(Equal("/networking/v1/external/policies"))
+		Expect(token).To(Equal("some-token"))
+	})
+
+	It("sends the app filters to the server", func() {
+		q := policy_client.NewPolicyQuery().
+			IDs("app-a", "app-b").
+			SourceIDs("app-a").
+			DestinationIDs("app-b", "app-c")
+		_, err := client.QueryPolicies("some-token", q)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, route, _, _, _ := jsonClient.DoArgsForCall(0)
+		Expect(route).To(Equal("/networking/v1/external/policies?id=app-a,app-b&source_id=app-a&dest_id=app-b,app-c"))
+	})
+
+	It("filters the response on the client", func() {
+		policies, err := client.QueryPolicies("some-token", policy_client.NewPolicyQuery().SourceIDs("app-a"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal(current[:2]))
+
+		policies, err = client.QueryPolicies("some-token", policy_client.NewPolicyQuery().DestinationIDs("app-a"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal(current[2:]))
+
+		policies, err = client.QueryPolicies("some-token", policy_client.NewPolicyQuery().Protocol("tcp").Port(8085))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal(current[:1]))
+
+		policies, err = client.QueryPolicies("some-token", policy_client.NewPolicyQuery().IDs("app-b"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal(current[:1]))
+	})
+
+	It("does not change the query it was built from", func() {
+		base := policy_client.NewPolicyQuery().SourceIDs("app-a")
+		base.SourceIDs("app-c")
+		policies, err := client.QueryPolicies("some-token", base)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(HaveLen(2))
+	})
+
+	It("escapes ids", func() {
+		_, err := client.QueryPolicies("some-token", policy_client.NewPolicyQuery().IDs("a&b"))
+		Expect(err).NotTo(HaveOccurred())
+		_, route, _, _, _ := jsonClient.DoArgsForCall(0)
+		Expect(route).To(Equal("/networking/v1/external/policies?id=a%26b"))
+	})
+
+	Context("when the json client fails", func() {
+		BeforeEach(func() {
+			jsonClient.DoStub = nil
+			jsonClient.DoReturns(errors.New("banana"))
+		})
+		It("returns the error", func() {
+			_, err := client.QueryPolicies("some-token", policy_client.NewPolicyQuery())
+			Expect(err).To(MatchError("banana"))
+		})
+	})
+
+	Context("when the json client gets a bad status code", func() {
+		BeforeEach(func() {
+			jsonClient.DoStub = nil
+			jsonClient.DoReturns(&json_client.HttpResponseCodeError{
+				StatusCode: http.StatusTeapot,
+				Message:    "some-error",
+			})
+		})
+		It("parses out the error body", func() {
+			_, err := client.QueryPolicies("some-token", policy_client.NewPolicyQuery())
+			Expect(err).To(MatchError("418 I'm a teapot: some-error"))
+		})
+	})
+})
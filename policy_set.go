@@ -0,0 +1,125 @@
+package policy_client
+
+import "sort"
+
+// PolicyKey identifies a policy by the traffic it allows. Tags are not part
+// of it because the policy server assigns them, so the same policy may be
+// seen with and without tags.
+type PolicyKey struct {
+	SourceID      string
+	DestinationID string
+	Protocol      string
+	StartPort     int
+	EndPort       int
+}
+
+func (p Policy) Key() PolicyKey {
+	return PolicyKey{
+		SourceID:      p.Source.ID,
+		DestinationID: p.Destination.ID,
+		Protocol:      p.Destination.Protocol,
+		StartPort:     p.Destination.Ports.Start,
+		EndPort:       p.Destination.Ports.End,
+	}
+}
+
+// PolicySet is a set of policies keyed by PolicyKey. When policies with the
+// same key are added, the first one, including its tags, is kept. The zero
+// value is an empty set ready to use.
+type PolicySet struct {
+	policies map[PolicyKey]Policy
+}
+
+func NewPolicySet(policies ...Policy) *PolicySet {
+	s := &PolicySet{policies: make(map[PolicyKey]Policy, len(policies))}
+	s.Add(policies...)
+	return s
+}
+
+func (s *PolicySet) Add(policies ...Policy) {
+	if s.policies == nil {
+		s.policies = make(map[PolicyKey]Policy, len(policies))
+	}
+	for _, p := range policies {
+		key := p.Key()
+		if _, ok := s.policies[key]; !ok {
+			s.policies[key] = p
+		}
+	}
+}
+
+func (s *PolicySet) Remove(policies ...Policy) {
+	for _, p := range policies {
+		delete(s.policies, p.Key())
+	}
+}
+
+func (s *PolicySet) Contains(p Policy) bool {
+	_, ok := s.policies[p.Key()]
+	return ok
+}
+
+func (s *PolicySet) Len() int {
+	return len(s.policies)
+}
+
+// Union returns a new set with the policies in either set. Policies in
+// both keep the tags from s.
+func (s *PolicySet) Union(other *PolicySet) *PolicySet {
+	result := NewPolicySet()
+	for _, p := range s.policies {
+		result.Add(p)
+	}
+	for _, p := range other.policies {
+		result.Add(p)
+	}
+	return result
+}
+
+// Intersect returns a new set with the policies of s that are also in
+// other.
+func (s *PolicySet) Intersect(other *PolicySet) *PolicySet {
+	result := NewPolicySet()
+	for key, p := range s.policies {
+		if _, ok := other.policies[key]; ok {
+			result.Add(p)
+		}
+	}
+	return result
+}
+
+// Difference returns a new set with the policies of s that are not in
+// other.
+func (s *PolicySet) Difference(other *PolicySet) *PolicySet {
+	result := NewPolicySet()
+	for key, p := range s.policies {
+		if _, ok := other.policies[key]; !ok {
+			result.Add(p)
+		}
+	}
+	return result
+}
+
+// Equal reports whether both sets contain the same keys. Tags are not
+// compared.
+func (s *PolicySet) Equal(other *PolicySet) bool {
+	if s.Len() != other.Len() {
+		return false
+	}
+	for key := range s.policies {
+		if _, ok := other.policies[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Slice returns the policies in PolicySlice order.
+func (s *PolicySet) Slice() []Policy {
+	policies := make([]Policy, 0, len(s.policies))
+	for _, p := range s.policies {
+		policies = append(policies, p)
+	}
+	sort.Sort(PolicySlice(policies))
+	return policies
+}
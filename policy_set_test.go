@@ -0,0 +1,95 @@
+package policy_client_test
+
+import (
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func testPolicy(source, destination string, start, end int) policy_client.Policy {
+	return policy_client.Policy{
+		Source: policy_client.Source{ID: source},
+		Destination: policy_client.Destination{
+			ID:       destination,
+			Protocol: "tcp",
+			Ports:    policy_client.Ports{Start: start, End: end},
+		},
+	}
+}
+
+var _ = Describe("PolicySet", func() {
+	var (
+		a, b, c policy_client.Policy
+		taggedA policy_client.Policy
+	)
+
+	BeforeEach(func() {
+		a = testPolicy("app-a", "app-b", 8080, 8080)
+		b = testPolicy("app-a", "app-c", 8080, 8090)
+		c = testPolicy("app-b", "app-c", 443, 443)
+		taggedA = a
+		taggedA.Source.Tag = "0001"
+		taggedA.Destination.Tag = "0002"
+	})
+
+	It("de-duplicates policies by key, ignoring tags", func() {
+		set := policy_client.NewPolicySet(taggedA, b, a, b)
+		Expect(set.Len()).To(Equal(2))
+		Expect(set.Contains(a)).To(BeTrue())
+		Expect(set.Contains(c)).To(BeFalse())
+		Expect(set.Slice()).To(Equal([]policy_client.Policy{taggedA, b}))
+	})
+
+	It("distinguishes port ranges and protocols", func() {
+		udp := a
+		udp.Destination.Protocol = "udp"
+		wider := a
+		wider.Destination.Ports.End = 8081
+		Expect(policy_client.NewPolicySet(a, udp, wider).Len()).To(Equal(3))
+	})
+
+	It("supports add and remove on the zero value", func() {
+		var set policy_client.PolicySet
+		Expect(set.Contains(a)).To(BeFalse())
+		set.Add(a, b)
+		set.Remove(taggedA)
+		Expect(set.Slice()).To(Equal([]policy_client.Policy{b}))
+	})
+
+	Describe("set algebra", func() {
+		var left, right *policy_client.PolicySet
+
+		BeforeEach(func() {
+			left = policy_client.NewPolicySet(taggedA, b)
+			right = policy_client.NewPolicySet(a, c)
+		})
+
+		It("computes the union", func() {
+			Expect(left.Union(right).Slice()).To(Equal([]policy_client.Policy{taggedA, b, c}))
+		})
+
+		It("computes the intersection", func() {
+			Expect(left.Intersect(right).Slice()).To(Equal([]policy_client.Policy{taggedA}))
+			Expect(right.Intersect(left).Slice()).To(Equal([]policy_client.Policy{a}))
+		})
+
+		It("computes the difference", func() {
+			Expect(left.Difference(right).Slice()).To(Equal([]policy_client.Policy{b}))
+			Expect(right.Difference(left).Slice()).To(Equal([]policy_client.Policy{c}))
+		})
+
+		It("does not modify the operands", func() {
+			left.Union(right)
+			left.Difference(right)
+			Expect(left.Len()).To(Equal(2))
+			Expect(right.Len()).To(Equal(2))
+		})
+
+		It("compares sets by key", func() {
+			Expect(left.Equal(right)).To(BeFalse())
+			Expect(left.Equal(policy_client.NewPolicySet(b, a))).To(BeTrue())
+			Expect(left.Equal(policy_client.NewPolicySet(a))).To(BeFalse())
+		})
+	})
+})
@@ -1,10 +1,17 @@
 package policy_client
 
 import (
+	"cmp"
 	"encoding/json"
-	"strings"
+	"strconv"
+	"unicode/utf8"
 )
 
+// PolicySlice sorts policies in the byte order of their JSON encoding. It
+// compares field by field instead of encoding, so strings compare as JSON
+// text, ports compare as decimal text (8080 sorts before 999), a source
+// without a tag sorts after one with a tag and a destination without a tag
+// sorts before one with a tag.
 type PolicySlice []Policy
 
 func (s PolicySlice) Len() int {
@@ -12,19 +19,146 @@ func (s PolicySlice) Len() int {
 }
 
 func (s PolicySlice) Less(i, j int) bool {
-	a, err := json.Marshal(s[i])
-	if err != nil {
-		panic(err)
+	return comparePolicies(s[i], s[j]) < 0
+}
+
+func (s PolicySlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// PolicyV0Slice sorts v0 policies the same way as PolicySlice, with the
+// single destination port in place of the port range.
+type PolicyV0Slice []PolicyV0
+
+func (s PolicyV0Slice) Len() int {
+	return len(s)
+}
+
+func (s PolicyV0Slice) Less(i, j int) bool {
+	return comparePoliciesV0(s[i], s[j]) < 0
+}
+
+func (s PolicyV0Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// SecurityGroupSlice sorts security groups by GUID, then name.
+type SecurityGroupSlice []SecurityGroup
+
+func (s SecurityGroupSlice) Len() int {
+	return len(s)
+}
+
+func (s SecurityGroupSlice) Less(i, j int) bool {
+	return cmp.Or(
+		cmp.Compare(s[i].Guid, s[j].Guid),
+		cmp.Compare(s[i].Name, s[j].Name),
+	) < 0
+}
+
+func (s SecurityGroupSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// comparePolicies compares each field as the bytes it encodes to,
+// including the byte that follows it in the encoding, which decides the
+// order when one field is a prefix of the other.
+func comparePolicies(a, b Policy) int {
+	return cmp.Or(
+		compareJSONStrings(a.Source.ID, b.Source.ID),
+		compareSourceTags(a.Source.Tag, b.Source.Tag),
+		compareJSONStrings(a.Destination.ID, b.Destination.ID),
+		compareDestinationTags(a.Destination.Tag, b.Destination.Tag),
+		compareJSONStrings(a.Destination.Protocol, b.Destination.Protocol),
+		compareJSONInts(a.Destination.Ports.Start, b.Destination.Ports.Start, ','),
+		compareJSONInts(a.Destination.Ports.End, b.Destination.Ports.End, '}'),
+	)
+}
+
+func comparePoliciesV0(a, b PolicyV0) int {
+	return cmp.Or(
+		compareJSONStrings(a.Source.ID, b.Source.ID),
+		compareSourceTags(a.Source.Tag, b.Source.Tag),
+		compareJSONStrings(a.Destination.ID, b.Destination.ID),
+		compareDestinationTags(a.Destination.Tag, b.Destination.Tag),
+		compareJSONStrings(a.Destination.Protocol, b.Destination.Protocol),
+		compareJSONInts(a.Destination.Port, b.Destination.Port, '}'),
+	)
+}
+
+// compareSourceTags orders an omitted tag, followed by `}`, after a
+// present one, followed by `,"tag"`.
+func compareSourceTags(a, b string) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
 	}
+	return compareJSONStrings(a, b)
+}
 
-	b, err := json.Marshal(s[j])
-	if err != nil {
-		panic(err)
+// compareDestinationTags orders an omitted tag, followed by `,"protocol"`,
+// before a present one, followed by `,"tag"`.
+func compareDestinationTags(a, b string) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
 	}
+	return compareJSONStrings(a, b)
+}
 
-	return strings.Compare(string(a), string(b)) < 0
+func compareJSONStrings(a, b string) int {
+	if needsJSONEscape(a) || needsJSONEscape(b) {
+		a, b = jsonString(a), jsonString(b)
+	}
+	return compareTerminated(a, b, '"')
 }
 
-func (s PolicySlice) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
+func compareJSONInts(a, b int, terminator byte) int {
+	var bufA, bufB [20]byte
+	return compareTerminated(strconv.AppendInt(bufA[:0], int64(a), 10), strconv.AppendInt(bufB[:0], int64(b), 10), terminator)
+}
+
+// compareTerminated compares a and b as if each were followed by
+// terminator.
+func compareTerminated[T string | []byte](a, b T, terminator byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return cmp.Compare(a[i], b[i])
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return cmp.Compare(terminator, b[n])
+	case len(a) > len(b):
+		return cmp.Compare(a[n], terminator)
+	}
+	return 0
+}
+
+// needsJSONEscape reports whether encoding/json would write s other than
+// as is.
+func needsJSONEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20, c == '"', c == '\\', c == '<', c == '>', c == '&', c >= utf8.RuneSelf:
+			return true
+		}
+	}
+	return false
+}
+
+// jsonString returns s as encoding/json writes it, without the quotes.
+func jsonString(s string) string {
+	// strings always encode, with invalid UTF-8 replaced
+	encoded, _ := json.Marshal(s)
+	return string(encoded[1 : len(encoded)-1])
 }
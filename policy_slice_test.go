@@ -1,6 +1,12 @@
 package policy_client_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
 	"code.cloudfoundry.org/policy_client"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -151,6 +157,51 @@ var _ = Describe("PolicySlice", func() {
 			Expect(slice.Less(0, 5)).To(Equal(!slice.Less(5, 0)))
 		})
 
+		It("orders by source id and tag, then destination id, tag, protocol and ports", func() {
+			sorted := make([]policy_client.Policy, len(policies))
+			copy(sorted, policies)
+			sort.Sort(policy_client.PolicySlice(sorted))
+			Expect(sorted).To(Equal([]policy_client.Policy{
+				policies[0], policies[4], policies[5], policies[3], policies[1], policies[2],
+			}))
+		})
+
+		It("orders the same as the JSON encoding", func() {
+			edgeCases := []policy_client.Policy{
+				testPolicy("a", "b", 8080, 8080),
+				testPolicy("a", "b", 999, 999),
+				testPolicy("a", "b", 80, 80),
+				testPolicy("a", "b", 80, 8080),
+				testPolicy("a", "b", 80, 9),
+				testPolicy("a", "b!", 80, 80),
+				testPolicy("a", "b ", 80, 80),
+				testPolicy("a", "b<", 80, 80),
+				testPolicy("a", "b\\", 80, 80),
+				testPolicy("a", "bé", 80, 80),
+				testPolicy("a", "b\n", 80, 80),
+				testPolicy("a", "b\xff", 80, 80),
+				testPolicy("a!", "b", 80, 80),
+				testPolicy("ab", "b", 80, 80),
+			}
+			for _, policy := range edgeCases[:5] {
+				tagged := policy
+				tagged.Source.Tag = "0001"
+				edgeCases = append(edgeCases, tagged)
+				tagged = policy
+				tagged.Destination.Tag = "0002"
+				edgeCases = append(edgeCases, tagged)
+				tagged.Destination.Protocol = "udp"
+				edgeCases = append(edgeCases, tagged)
+			}
+
+			slice := policy_client.PolicySlice(edgeCases)
+			reference := jsonPolicySlice(edgeCases)
+			for i := range edgeCases {
+				for j := range edgeCases {
+					Expect(slice.Less(i, j)).To(Equal(reference.Less(i, j)), "comparing %+v and %+v", edgeCases[i], edgeCases[j])
+				}
+			}
+		})
 	})
 
 	Describe("Swap", func() {
@@ -161,3 +212,79 @@ var _ = Describe("PolicySlice", func() {
 		})
 	})
 })
+
+var _ = Describe("PolicyV0Slice", func() {
+	It("sorts by source, then destination, in JSON order", func() {
+		policies := []policy_client.PolicyV0{
+			{Source: policy_client.SourceV0{ID: "b"}, Destination: policy_client.DestinationV0{ID: "a", Protocol: "tcp", Port: 80}},
+			{Source: policy_client.SourceV0{ID: "a"}, Destination: policy_client.DestinationV0{ID: "a", Protocol: "tcp", Port: 8080}},
+			{Source: policy_client.SourceV0{ID: "a"}, Destination: policy_client.DestinationV0{ID: "a", Protocol: "tcp", Port: 80}},
+		}
+		sort.Sort(policy_client.PolicyV0Slice(policies))
+		Expect(policies[0].Destination.Port).To(Equal(8080))
+		Expect(policies[1].Destination.Port).To(Equal(80))
+		Expect(policies[2].Source.ID).To(Equal("b"))
+	})
+})
+
+var _ = Describe("SecurityGroupSlice", func() {
+	It("sorts by guid, then name", func() {
+		groups := []policy_client.SecurityGroup{
+			{Guid: "b", Name: "a"},
+			{Guid: "a", Name: "b"},
+			{Guid: "a", Name: "a"},
+		}
+		sort.Sort(policy_client.SecurityGroupSlice(groups))
+		Expect(groups).To(Equal([]policy_client.SecurityGroup{
+			{Guid: "a", Name: "a"},
+			{Guid: "a", Name: "b"},
+			{Guid: "b", Name: "a"},
+		}))
+	})
+})
+
+// jsonPolicySlice is the previous PolicySlice implementation, kept to
+// check the ordering is unchanged and to compare against in the benchmarks.
+type jsonPolicySlice []policy_client.Policy
+
+func (s jsonPolicySlice) Len() int      { return len(s) }
+func (s jsonPolicySlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s jsonPolicySlice) Less(i, j int) bool {
+	a, _ := json.Marshal(s[i])
+	b, _ := json.Marshal(s[j])
+	return strings.Compare(string(a), string(b)) < 0
+}
+
+func benchmarkPolicies(n int) []policy_client.Policy {
+	policies := make([]policy_client.Policy, n)
+	for i := range policies {
+		policies[i] = policy_client.Policy{
+			Source: policy_client.Source{ID: fmt.Sprintf("app-%08d", (i*7919)%n)},
+			Destination: policy_client.Destination{
+				ID:       fmt.Sprintf("app-%08d", (i*104729)%n),
+				Protocol: "tcp",
+				Ports:    policy_client.Ports{Start: 8080, End: 8080 + i%10},
+			},
+		}
+	}
+	return policies
+}
+
+func benchmarkSort(b *testing.B, sortable func([]policy_client.Policy) sort.Interface) {
+	policies := benchmarkPolicies(10000)
+	work := make([]policy_client.Policy, len(policies))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(work, policies)
+		sort.Sort(sortable(work))
+	}
+}
+
+func BenchmarkPolicySliceSort(b *testing.B) {
+	benchmarkSort(b, func(p []policy_client.Policy) sort.Interface { return policy_client.PolicySlice(p) })
+}
+
+func BenchmarkJSONPolicySliceSort(b *testing.B) {
+	benchmarkSort(b, func(p []policy_client.Policy) sort.Interface { return jsonPolicySlice(p) })
+}
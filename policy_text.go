@@ -0,0 +1,192 @@
+package policy_client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The policy text format has one policy per line:
+//
+//	# comment
+//	app-a -> app-b tcp 8080-8090
+//	app-a[0001] -> app-b[0002] udp 53
+//
+// Tags in brackets are optional. Blank lines and everything after a # are
+// ignored.
+
+// LineError is a problem parsing line Line, counting from 1.
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ParseError lists every line that could not be parsed.
+type ParseError []LineError
+
+func (e ParseError) Error() string {
+	messages := make([]string, len(e))
+	for i, lineErr := range e {
+		messages[i] = lineErr.Error()
+	}
+	return "invalid policy text: " + strings.Join(messages, "; ")
+}
+
+// ParsePolicies parses policies in the policy text format.
+func ParsePolicies(text string) ([]Policy, error) {
+	policies := []Policy{}
+	var errs ParseError
+	for i, line := range strings.Split(text, "\n") {
+		policy, ok, err := parsePolicyLine(line)
+		if err != nil {
+			errs = append(errs, LineError{Line: i + 1, Message: err.Error()})
+			continue
+		}
+		if ok {
+			policies = append(policies, policy)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return policies, nil
+}
+
+// ParsePoliciesV0 parses policies in the policy text format. Every policy
+// must have a single port.
+func ParsePoliciesV0(text string) ([]PolicyV0, error) {
+	policies := []PolicyV0{}
+	var errs ParseError
+	for i, line := range strings.Split(text, "\n") {
+		policy, ok, err := parsePolicyLine(line)
+		if err == nil && ok && policy.Destination.Ports.Start != policy.Destination.Ports.End {
+			err = fmt.Errorf("v0 policies have a single port, not %d-%d", policy.Destination.Ports.Start, policy.Destination.Ports.End)
+		}
+		if err != nil {
+			errs = append(errs, LineError{Line: i + 1, Message: err.Error()})
+			continue
+		}
+		if ok {
+			converted, _ := ToV0(policy)
+			policies = append(policies, converted...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return policies, nil
+}
+
+// parsePolicyLine returns false for lines without a policy.
+func parsePolicyLine(line string) (Policy, bool, error) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Policy{}, false, nil
+	}
+	if len(fields) != 5 || fields[1] != "->" {
+		return Policy{}, false, fmt.Errorf("expected \"source -> destination protocol ports\", got %q", strings.TrimSpace(line))
+	}
+
+	sourceID, sourceTag, err := parseTaggedID(fields[0])
+	if err != nil {
+		return Policy{}, false, err
+	}
+	destinationID, destinationTag, err := parseTaggedID(fields[2])
+	if err != nil {
+		return Policy{}, false, err
+	}
+	ports, err := parseTextPorts(fields[4])
+	if err != nil {
+		return Policy{}, false, err
+	}
+
+	return Policy{
+		Source: Source{ID: sourceID, Tag: sourceTag},
+		Destination: Destination{
+			ID:       destinationID,
+			Tag:      destinationTag,
+			Protocol: fields[3],
+			Ports:    ports,
+		},
+	}, true, nil
+}
+
+func parseTaggedID(field string) (string, string, error) {
+	open := strings.Index(field, "[")
+	if open < 0 {
+		if strings.Contains(field, "]") {
+			return "", "", fmt.Errorf("invalid app %q", field)
+		}
+		return field, "", nil
+	}
+	id, tag := field[:open], field[open+1:]
+	if id == "" || !strings.HasSuffix(tag, "]") || strings.ContainsAny(tag[:len(tag)-1], "[]") {
+		return "", "", fmt.Errorf("invalid app %q", field)
+	}
+	return id, tag[:len(tag)-1], nil
+}
+
+func parseTextPorts(field string) (Ports, error) {
+	start, end, isRange := strings.Cut(field, "-")
+	startPort, err := strconv.Atoi(start)
+	if err != nil {
+		return Ports{}, fmt.Errorf("invalid ports %q", field)
+	}
+	if !isRange {
+		return Ports{Start: startPort, End: startPort}, nil
+	}
+	endPort, err := strconv.Atoi(end)
+	if err != nil {
+		return Ports{}, fmt.Errorf("invalid ports %q", field)
+	}
+	return Ports{Start: startPort, End: endPort}, nil
+}
+
+// FormatPolicy returns the policy in the policy text format, which
+// ParsePolicies reads back.
+func FormatPolicy(p Policy) string {
+	ports := strconv.Itoa(p.Destination.Ports.Start)
+	if p.Destination.Ports.End != p.Destination.Ports.Start {
+		ports += "-" + strconv.Itoa(p.Destination.Ports.End)
+	}
+	return fmt.Sprintf("%s -> %s %s %s",
+		formatTaggedID(p.Source.ID, p.Source.Tag),
+		formatTaggedID(p.Destination.ID, p.Destination.Tag),
+		p.Destination.Protocol,
+		ports,
+	)
+}
+
+func FormatPolicyV0(p PolicyV0) string {
+	return FormatPolicy(ToV1(p))
+}
+
+// FormatPolicies returns one line per policy, in PolicySlice order so the
+// text is stable for diffs.
+func FormatPolicies(policies []Policy) string {
+	sorted := make([]Policy, len(policies))
+	copy(sorted, policies)
+	sort.Sort(PolicySlice(sorted))
+
+	var text strings.Builder
+	for _, policy := range sorted {
+		text.WriteString(FormatPolicy(policy))
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+func formatTaggedID(id, tag string) string {
+	if tag == "" {
+		return id
+	}
+	return id + "[" + tag + "]"
+}
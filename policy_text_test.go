@@ -0,0 +1,100 @@
+package policy_client_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy text", func() {
+	Describe("ParsePolicies", func() {
+		It("parses policies, tags and comments", func() {
+			policies, err := policy_client.ParsePolicies(`
+# frontend
+app-a -> app-b tcp 8080-8090
+app-a[0001] -> app-c[0002] udp 53   # dns
+
+`)
+			Expect(err).NotTo(HaveOccurred())
+
+			tagged := testPolicy("app-a", "app-c", 53, 53)
+			tagged.Source.Tag = "0001"
+			tagged.Destination.Tag = "0002"
+			tagged.Destination.Protocol = "udp"
+			Expect(policies).To(Equal([]policy_client.Policy{
+				testPolicy("app-a", "app-b", 8080, 8090),
+				tagged,
+			}))
+		})
+
+		It("returns nothing for empty text", func() {
+			policies, err := policy_client.ParsePolicies("# nothing here\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies).To(BeEmpty())
+		})
+
+		It("reports every bad line by number", func() {
+			_, err := policy_client.ParsePolicies("app-a -> app-b tcp 8080\napp-a => app-b tcp 80\napp-a[01 -> app-b tcp 80\napp-a -> app-b tcp http\n")
+
+			var parseErr policy_client.ParseError
+			Expect(errors.As(err, &parseErr)).To(BeTrue())
+			Expect(parseErr).To(Equal(policy_client.ParseError{
+				{Line: 2, Message: `expected "source -> destination protocol ports", got "app-a => app-b tcp 80"`},
+				{Line: 3, Message: `invalid app "app-a[01"`},
+				{Line: 4, Message: `invalid ports "http"`},
+			}))
+			Expect(err.Error()).To(HavePrefix(`invalid policy text: line 2: expected`))
+		})
+	})
+
+	Describe("ParsePoliciesV0", func() {
+		It("parses single port policies", func() {
+			policies, err := policy_client.ParsePoliciesV0("app-a[0001] -> app-b tcp 8080")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies).To(Equal([]policy_client.PolicyV0{{
+				Source:      policy_client.SourceV0{ID: "app-a", Tag: "0001"},
+				Destination: policy_client.DestinationV0{ID: "app-b", Protocol: "tcp", Port: 8080},
+			}}))
+		})
+
+		It("rejects port ranges", func() {
+			_, err := policy_client.ParsePoliciesV0("\napp-a -> app-b tcp 8080-8081")
+			Expect(err).To(MatchError("invalid policy text: line 2: v0 policies have a single port, not 8080-8081"))
+		})
+	})
+
+	Describe("FormatPolicy", func() {
+		It("formats policies the way they are parsed", func() {
+			policy := testPolicy("app-a", "app-b", 8080, 8090)
+			policy.Source.Tag = "0001"
+			Expect(policy_client.FormatPolicy(policy)).To(Equal("app-a[0001] -> app-b tcp 8080-8090"))
+			Expect(policy_client.FormatPolicy(testPolicy("app-a", "app-b", 443, 443))).To(Equal("app-a -> app-b tcp 443"))
+
+			Expect(policy_client.FormatPolicyV0(policy_client.PolicyV0{
+				Source:      policy_client.SourceV0{ID: "app-a"},
+				Destination: policy_client.DestinationV0{ID: "app-b", Tag: "0002", Protocol: "udp", Port: 53},
+			})).To(Equal("app-a -> app-b[0002] udp 53"))
+		})
+
+		It("round trips", func() {
+			text := "app-a[0001] -> app-c[0002] tcp 8080-8090\napp-a -> app-b tcp 443\napp-b -> app-a udp 53\n"
+			policies, err := policy_client.ParsePolicies(text)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy_client.FormatPolicies(policies)).To(Equal(text))
+		})
+	})
+
+	Describe("FormatPolicies", func() {
+		It("sorts the lines without changing the input", func() {
+			policies := []policy_client.Policy{
+				testPolicy("app-b", "app-a", 80, 80),
+				testPolicy("app-a", "app-b", 80, 80),
+			}
+			Expect(policy_client.FormatPolicies(policies)).To(Equal("app-a -> app-b tcp 80\napp-b -> app-a tcp 80\n"))
+			Expect(policies[0].Source.ID).To(Equal("app-b"))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package policy_client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// FieldError is a problem with one field of the policy at Index in a
+// batch. Field is the JSON path of the field.
+type FieldError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("policy %d: %s %s", e.Index, e.Field, e.Message)
+}
+
+// ValidationError lists every problem found in a batch of policies.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Error()
+	}
+	return "invalid policies: " + strings.Join(messages, "; ")
+}
+
+// Validate checks the policy the way the policy server does, returning a
+// ValidationError with Index 0 when it is invalid.
+func (p Policy) Validate() error {
+	if errs := p.validate(0); len(errs) > 0 {
+		return ValidationError(errs)
+	}
+	return nil
+}
+
+// ValidatePolicies validates each policy and checks the batch has no
+// duplicates, which the policy server rejects.
+func ValidatePolicies(policies []Policy) error {
+	var errs ValidationError
+	seen := map[PolicyKey]int{}
+	for i, policy := range policies {
+		errs = append(errs, policy.validate(i)...)
+		if first, ok := seen[policy.Key()]; ok {
+			errs = append(errs, FieldError{Index: i, Field: "policy", Message: fmt.Sprintf("duplicates policy %d", first)})
+			continue
+		}
+		seen[policy.Key()] = i
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p Policy) validate(index int) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Index: index, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !guidPattern.MatchString(p.Source.ID) {
+		add("source.id", "%q is not a guid", p.Source.ID)
+	}
+	if !guidPattern.MatchString(p.Destination.ID) {
+		add("destination.id", "%q is not a guid", p.Destination.ID)
+	}
+	switch p.Destination.Protocol {
+	case "tcp", "udp", "icmp":
+	default:
+		add("destination.protocol", "%q is not tcp, udp or icmp", p.Destination.Protocol)
+	}
+
+	ports := p.Destination.Ports
+	if ports.Start < 1 || ports.Start > 65535 {
+		add("destination.ports.start", "%d is not between 1 and 65535", ports.Start)
+	}
+	if ports.End < 1 || ports.End > 65535 {
+		add("destination.ports.end", "%d is not between 1 and 65535", ports.End)
+	}
+	if ports.Start > ports.End {
+		add("destination.ports", "start %d is greater than end %d", ports.Start, ports.End)
+	}
+	return errs
+}
@@ -0,0 +1,111 @@
+package policy_client_test
+
+import (
+	"errors"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	sourceGuid      = "1f3c4bd8-6a63-4a39-9b3a-1b6f2e0d6a01"
+	destinationGuid = "7e2d9a44-0c1b-4c7e-8f25-5d3b9c1e2f02"
+)
+
+var _ = Describe("Policy validation", func() {
+	var policy policy_client.Policy
+
+	BeforeEach(func() {
+		policy = testPolicy(sourceGuid, destinationGuid, 8080, 8090)
+	})
+
+	Describe("Validate", func() {
+		It("accepts a valid policy", func() {
+			Expect(policy.Validate()).To(Succeed())
+			policy.Destination.Protocol = "icmp"
+			Expect(policy.Validate()).To(Succeed())
+		})
+
+		It("reports every invalid field", func() {
+			policy.Source.ID = "app-a"
+			policy.Destination.Protocol = "sctp"
+			policy.Destination.Ports = policy_client.Ports{Start: 70000, End: 0}
+
+			err := policy.Validate()
+			var validationErr policy_client.ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr).To(Equal(policy_client.ValidationError{
+				{Index: 0, Field: "source.id", Message: `"app-a" is not a guid`},
+				{Index: 0, Field: "destination.protocol", Message: `"sctp" is not tcp, udp or icmp`},
+				{Index: 0, Field: "destination.ports.start", Message: "70000 is not between 1 and 65535"},
+				{Index: 0, Field: "destination.ports.end", Message: "0 is not between 1 and 65535"},
+				{Index: 0, Field: "destination.ports", Message: "start 70000 is greater than end 0"},
+			}))
+		})
+
+		It("formats the errors", func() {
+			policy.Destination.Ports = policy_client.Ports{Start: 9000, End: 8000}
+			Expect(policy.Validate()).To(MatchError("invalid policies: policy 0: destination.ports start 9000 is greater than end 8000"))
+		})
+	})
+
+	Describe("ValidatePolicies", func() {
+		It("reports errors by index, including duplicates", func() {
+			invalid := policy
+			invalid.Destination.ID = ""
+			duplicate := policy
+			duplicate.Source.Tag = "0001"
+
+			err := policy_client.ValidatePolicies([]policy_client.Policy{policy, invalid, duplicate})
+			Expect(err).To(Equal(policy_client.ValidationError{
+				{Index: 1, Field: "destination.id", Message: `"" is not a guid`},
+				{Index: 2, Field: "policy", Message: "duplicates policy 0"},
+			}))
+		})
+
+		It("returns nil for valid policies", func() {
+			Expect(policy_client.ValidatePolicies(nil)).To(Succeed())
+			Expect(policy_client.ValidatePolicies([]policy_client.Policy{policy})).To(Succeed())
+		})
+	})
+
+	Describe("ValidateBeforeAdd", func() {
+		var (
+			client     *policy_client.ExternalClient
+			jsonClient *hfakes.JSONClient
+		)
+
+		BeforeEach(func() {
+			jsonClient = &hfakes.JSONClient{}
+			client = &policy_client.ExternalClient{
+				JsonClient:        jsonClient,
+				Chunker:           &policy_client.SimpleChunker{},
+				ValidateBeforeAdd: true,
+			}
+		})
+
+		It("posts valid policies", func() {
+			Expect(client.AddPolicies("some-token", []policy_client.Policy{policy})).To(Succeed())
+			Expect(jsonClient.DoCallCount()).To(Equal(1))
+		})
+
+		It("does not post invalid policies", func() {
+			err := client.AddPolicies("some-token", []policy_client.Policy{policy, policy})
+			Expect(err).To(MatchError("invalid policies: policy 1: policy duplicates policy 0"))
+			Expect(jsonClient.DoCallCount()).To(Equal(0))
+		})
+
+		It("validates v0 policies", func() {
+			policyV0 := policy_client.PolicyV0{
+				Source:      policy_client.SourceV0{ID: sourceGuid},
+				Destination: policy_client.DestinationV0{ID: destinationGuid, Protocol: "tcp", Port: 0},
+			}
+			err := client.AddPoliciesV0("some-token", []policy_client.PolicyV0{policyV0})
+			Expect(err).To(BeAssignableToTypeOf(policy_client.ValidationError{}))
+			Expect(jsonClient.DoCallCount()).To(Equal(0))
+		})
+	})
+})
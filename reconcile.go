@@ -0,0 +1,70 @@
+package policy_client
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReconcilePlan lists the policies to add and delete, in PolicySlice order.
+type ReconcilePlan struct {
+	Add    []Policy `json:"add"`
+	Delete []Policy `json:"delete"`
+}
+
+func (p ReconcilePlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Delete) == 0
+}
+
+// ReconcileResult lists the policies that were added and deleted.
+type ReconcileResult struct {
+	Added   []Policy `json:"added"`
+	Deleted []Policy `json:"deleted"`
+}
+
+// ReconcilePolicies makes the policies matching scope on the server equal
+// to desired. Policies outside scope are left alone, and a desired policy
+// outside scope is an error. Policies are added before others are deleted,
+// so traffic allowed by both the old and new sets is never interrupted.
+func (c *ExternalClient) ReconcilePolicies(ctx context.Context, token string, desired []Policy, scope Selector) (ReconcilePlan, ReconcileResult, error) {
+	for _, policy := range desired {
+		if !scope.Matches(policy) {
+			return ReconcilePlan{}, ReconcileResult{}, fmt.Errorf("desired policy from %s to %s is outside the scope",
+				policy.Source.ID, policy.Destination.ID)
+		}
+	}
+
+	current, err := c.getPoliciesMatching(token, scope)
+	if err != nil {
+		return ReconcilePlan{}, ReconcileResult{}, err
+	}
+
+	desiredSet := NewPolicySet(desired...)
+	currentSet := NewPolicySet(current...)
+	plan := ReconcilePlan{
+		Add:    desiredSet.Difference(currentSet).Slice(),
+		Delete: currentSet.Difference(desiredSet).Slice(),
+	}
+
+	var result ReconcileResult
+	if len(plan.Add) > 0 {
+		if err := ctx.Err(); err != nil {
+			return plan, result, err
+		}
+		err = c.AddPolicies(token, plan.Add)
+		if err != nil {
+			return plan, result, fmt.Errorf("adding policies: %w", err)
+		}
+		result.Added = plan.Add
+	}
+	if len(plan.Delete) > 0 {
+		if err := ctx.Err(); err != nil {
+			return plan, result, err
+		}
+		err = c.DeletePolicies(token, plan.Delete)
+		if err != nil {
+			return plan, result, fmt.Errorf("deleting policies: %w", err)
+		}
+		result.Deleted = plan.Delete
+	}
+	return plan, result, nil
+}
@@ -0,0 +1,138 @@
+package policy_client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReconcilePolicies", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		current    []policy_client.Policy
+		posts      map[string][]policy_client.Policy
+		getRoutes  []string
+		scope      policy_client.Selector
+	)
+
+	BeforeEach(func() {
+		current = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8080),
+			testPolicy("app-a", "app-c", 8080, 8080),
+			testPolicy("app-x", "app-b", 9000, 9000),
+		}
+		current[0].Source.Tag = "0001"
+		posts = map[string][]policy_client.Policy{}
+		getRoutes = nil
+		scope = policy_client.Selector{SourceIDs: []string{"app-a"}}
+
+		jsonClient = &hfakes.JSONClient{}
+		jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+			if method == "GET" {
+				getRoutes = append(getRoutes, route)
+				body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": current})
+				return json.Unmarshal(body, respData)
+			}
+			posts[route] = append(posts[route], reqData.(map[string][]policy_client.Policy)["policies"]...)
+			return nil
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+			Chunker:    &policy_client.SimpleChunker{},
+		}
+	})
+
+	It("adds and deletes only what differs within the scope", func() {
+		desired := []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8080),
+			testPolicy("app-a", "app-d", 443, 443),
+		}
+		plan, result, err := client.ReconcilePolicies(context.Background(), "some-token", desired, scope)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getRoutes).To(Equal([]string{"/networking/v1/external/policies?id=app-a"}))
+		Expect(plan.Add).To(Equal([]policy_client.Policy{desired[1]}))
+		Expect(plan.Delete).To(Equal([]policy_client.Policy{current[1]}))
+		Expect(result.Added).To(Equal(plan.Add))
+		Expect(result.Deleted).To(Equal(plan.Delete))
+		Expect(posts).To(Equal(map[string][]policy_client.Policy{
+			"/networking/v1/external/policies":        plan.Add,
+			"/networking/v1/external/policies/delete": plan.Delete,
+		}))
+	})
+
+	It("does nothing when the server already matches", func() {
+		desired := []policy_client.Policy{current[1], testPolicy("app-a", "app-b", 8080, 8080)}
+		plan, result, err := client.ReconcilePolicies(context.Background(), "some-token", desired, scope)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Empty()).To(BeTrue())
+		Expect(result).To(Equal(policy_client.ReconcileResult{}))
+		Expect(posts).To(BeEmpty())
+	})
+
+	It("gets every policy when the scope names no apps", func() {
+		scope = policy_client.Selector{Protocol: "tcp", Ports: policy_client.Ports{Start: 9000, End: 9100}}
+		plan, _, err := client.ReconcilePolicies(context.Background(), "some-token", nil, scope)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRoutes).To(Equal([]string{"/networking/v1/external/policies"}))
+		Expect(plan.Delete).To(Equal([]policy_client.Policy{current[2]}))
+	})
+
+	Context("when a desired policy is outside the scope", func() {
+		It("returns an error without changing anything", func() {
+			desired := []policy_client.Policy{testPolicy("app-x", "app-b", 8080, 8080)}
+			_, _, err := client.ReconcilePolicies(context.Background(), "some-token", desired, scope)
+			Expect(err).To(MatchError("desired policy from app-x to app-b is outside the scope"))
+			Expect(jsonClient.DoCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when getting the policies fails", func() {
+		It("returns the error", func() {
+			jsonClient.DoStub = nil
+			jsonClient.DoReturns(errors.New("banana"))
+			_, _, err := client.ReconcilePolicies(context.Background(), "some-token", nil, scope)
+			Expect(err).To(MatchError("banana"))
+		})
+	})
+
+	Context("when deleting fails", func() {
+		It("returns the plan and what was added", func() {
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				if route == "/networking/v1/external/policies/delete" {
+					return errors.New("banana")
+				}
+				if method == "GET" {
+					body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": current})
+					return json.Unmarshal(body, respData)
+				}
+				return nil
+			}
+			desired := []policy_client.Policy{testPolicy("app-a", "app-d", 443, 443)}
+			plan, result, err := client.ReconcilePolicies(context.Background(), "some-token", desired, scope)
+			Expect(err).To(MatchError("deleting policies: banana"))
+			Expect(plan.Delete).To(HaveLen(2))
+			Expect(result.Added).To(Equal(desired))
+			Expect(result.Deleted).To(BeEmpty())
+		})
+	})
+
+	Context("when the context is cancelled", func() {
+		It("does not apply the plan", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			desired := []policy_client.Policy{testPolicy("app-a", "app-d", 443, 443)}
+			plan, _, err := client.ReconcilePolicies(ctx, "some-token", desired, scope)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(plan.Add).To(Equal(desired))
+			Expect(posts).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,475 @@
+package policy_client
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type FindingType string
+
+const (
+	FindingDuplicateRule     FindingType = "duplicate_rule"
+	FindingShadowedRule      FindingType = "shadowed_rule"
+	FindingAllProtocolShadow FindingType = "all_protocol_shadow"
+	FindingUnknownSpace      FindingType = "unknown_space"
+	FindingInvalidRule       FindingType = "invalid_rule"
+)
+
+type RuleRef struct {
+	GroupGuid string `json:"group_guid"`
+	RuleIndex int    `json:"rule_index"`
+}
+
+type Finding struct {
+	Type       FindingType `json:"type"`
+	GroupGuid  string      `json:"group_guid"`
+	Rule       *RuleRef    `json:"rule,omitempty"`
+	ShadowedBy *RuleRef    `json:"shadowed_by,omitempty"`
+	SpaceGuid  string      `json:"space_guid,omitempty"`
+	Lifecycle  string      `json:"lifecycle,omitempty"`
+	Message    string      `json:"message"`
+}
+
+// AnalyzeSecurityGroups reports rules that can be removed without changing
+// what any space is allowed to reach, and bindings to spaces that are not
+// in knownSpaceGuids. The space check is skipped when knownSpaceGuids is
+// nil.
+//
+// A rule is only reported as shadowed by a rule in a group that applies to
+// every space the shadowed rule's group applies to, for both staging and
+// running. A rule with Log set is never shadowed by one without it.
+func AnalyzeSecurityGroups(groups []SecurityGroup, knownSpaceGuids []string) []Finding {
+	var findings []Finding
+	var rules []analyzedRule
+
+	for g, group := range groups {
+		for i, rule := range group.Rules {
+			parsed, err := parseRule(rule)
+			if err != nil {
+				findings = append(findings, Finding{
+					Type:      FindingInvalidRule,
+					GroupGuid: group.Guid,
+					Rule:      &RuleRef{GroupGuid: group.Guid, RuleIndex: i},
+					Message:   err.Error(),
+				})
+				continue
+			}
+			rules = append(rules, analyzedRule{
+				parsedRule: parsed,
+				ref:        RuleRef{GroupGuid: group.Guid, RuleIndex: i},
+				group:      g,
+			})
+		}
+	}
+
+	groupRules := make([][]int, len(groups))
+	for i, rule := range rules {
+		groupRules[rule.group] = append(groupRules[rule.group], i)
+	}
+
+	scopes := newScopeIndex(groups)
+	for g := range groups {
+		if len(groupRules[g]) == 0 {
+			continue
+		}
+
+		// Only rules of groups that apply wherever this one does can shadow
+		// its rules. They are grouped by protocol and kept in rule order,
+		// so the first covering rule is reported.
+		covering := scopes.covering(g)
+		slices.Sort(covering)
+		byProtocol := map[string][]int{}
+		for _, c := range covering {
+			for _, j := range groupRules[c] {
+				byProtocol[rules[j].protocol] = append(byProtocol[rules[j].protocol], j)
+			}
+		}
+
+		for _, i := range groupRules[g] {
+			rule := rules[i]
+			candidates := byProtocol[rule.protocol]
+			if rule.protocol != "all" {
+				candidates = mergeIndexes(candidates, byProtocol["all"])
+			}
+			for _, j := range candidates {
+				other := rules[j]
+				if i == j || !other.covers(rule.parsedRule) {
+					continue
+				}
+
+				equivalent := rule.equal(other.parsedRule)
+				if equivalent && j > i && scopes.scopes[g].covers(scopes.scopes[other.group]) {
+					// the earlier of two identical rules is kept
+					continue
+				}
+				findings = append(findings, shadowFinding(rule, other, equivalent))
+				break
+			}
+		}
+	}
+
+	if knownSpaceGuids != nil {
+		known := make(map[string]bool, len(knownSpaceGuids))
+		for _, guid := range knownSpaceGuids {
+			known[guid] = true
+		}
+		for _, group := range groups {
+			findings = append(findings, unknownSpaceFindings(group, "staging", group.StagingSpaceGuids, known)...)
+			findings = append(findings, unknownSpaceFindings(group, "running", group.RunningSpaceGuids, known)...)
+		}
+	}
+
+	return findings
+}
+
+func shadowFinding(rule, other analyzedRule, equivalent bool) Finding {
+	finding := Finding{
+		GroupGuid:  rule.ref.GroupGuid,
+		Rule:       &RuleRef{GroupGuid: rule.ref.GroupGuid, RuleIndex: rule.ref.RuleIndex},
+		ShadowedBy: &RuleRef{GroupGuid: other.ref.GroupGuid, RuleIndex: other.ref.RuleIndex},
+	}
+	switch {
+	case equivalent:
+		finding.Type = FindingDuplicateRule
+		finding.Message = fmt.Sprintf("rule %d of security group %s duplicates rule %d of security group %s",
+			rule.ref.RuleIndex, rule.ref.GroupGuid, other.ref.RuleIndex, other.ref.GroupGuid)
+	case other.protocol == "all" && rule.protocol != "all":
+		finding.Type = FindingAllProtocolShadow
+		finding.Message = fmt.Sprintf("rule %d of security group %s is hidden by the all-protocol rule %d of security group %s",
+			rule.ref.RuleIndex, rule.ref.GroupGuid, other.ref.RuleIndex, other.ref.GroupGuid)
+	default:
+		finding.Type = FindingShadowedRule
+		finding.Message = fmt.Sprintf("rule %d of security group %s is shadowed by rule %d of security group %s",
+			rule.ref.RuleIndex, rule.ref.GroupGuid, other.ref.RuleIndex, other.ref.GroupGuid)
+	}
+	return finding
+}
+
+func unknownSpaceFindings(group SecurityGroup, lifecycle string, spaceGuids []string, known map[string]bool) []Finding {
+	var findings []Finding
+	for _, guid := range spaceGuids {
+		if known[guid] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Type:      FindingUnknownSpace,
+			GroupGuid: group.Guid,
+			SpaceGuid: guid,
+			Lifecycle: lifecycle,
+			Message:   fmt.Sprintf("security group %s is bound to unknown %s space %s", group.Guid, lifecycle, guid),
+		})
+	}
+	return findings
+}
+
+// mergeIndexes merges two ascending lists of rule indexes.
+func mergeIndexes(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] < b[0] {
+			merged, a = append(merged, a[0]), a[1:]
+		} else {
+			merged, b = append(merged, b[0]), b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// groupScope is where a security group applies, for each lifecycle.
+type groupScope struct {
+	staging lifecycleScope
+	running lifecycleScope
+}
+
+type lifecycleScope struct {
+	isDefault  bool
+	spaceGuids []string
+	spaces     map[string]bool
+}
+
+func newGroupScope(group SecurityGroup) groupScope {
+	return groupScope{
+		staging: newLifecycleScope(group.StagingDefault, group.StagingSpaceGuids),
+		running: newLifecycleScope(group.RunningDefault, group.RunningSpaceGuids),
+	}
+}
+
+func newLifecycleScope(isDefault bool, spaceGuids []string) lifecycleScope {
+	spaces := make(map[string]bool, len(spaceGuids))
+	for _, guid := range spaceGuids {
+		spaces[guid] = true
+	}
+	return lifecycleScope{isDefault: isDefault, spaceGuids: spaceGuids, spaces: spaces}
+}
+
+// scopeIndex finds the groups that apply wherever a group does from the
+// groups bound to one of its spaces, instead of checking every group.
+type scopeIndex struct {
+	scopes  []groupScope
+	staging lifecycleIndex
+	running lifecycleIndex
+}
+
+// lifecycleIndex lists the default groups and the groups bound to each
+// space for one lifecycle.
+type lifecycleIndex struct {
+	defaults []int
+	bySpace  map[string][]int
+}
+
+func newScopeIndex(groups []SecurityGroup) scopeIndex {
+	index := scopeIndex{
+		scopes:  make([]groupScope, len(groups)),
+		staging: lifecycleIndex{bySpace: map[string][]int{}},
+		running: lifecycleIndex{bySpace: map[string][]int{}},
+	}
+	for g, group := range groups {
+		index.scopes[g] = newGroupScope(group)
+		index.staging.add(g, index.scopes[g].staging)
+		index.running.add(g, index.scopes[g].running)
+	}
+	return index
+}
+
+func (x *lifecycleIndex) add(g int, scope lifecycleScope) {
+	if scope.isDefault {
+		x.defaults = append(x.defaults, g)
+		return
+	}
+	for guid := range scope.spaces {
+		x.bySpace[guid] = append(x.bySpace[guid], g)
+	}
+}
+
+// candidates returns the groups that may apply wherever narrow does in
+// this lifecycle, or false when any group may.
+func (x lifecycleIndex) candidates(narrow lifecycleScope) ([]int, bool) {
+	if narrow.isDefault {
+		return x.defaults, true
+	}
+	if len(narrow.spaceGuids) == 0 {
+		return nil, false
+	}
+	bound := x.bySpace[narrow.spaceGuids[0]]
+	for _, guid := range narrow.spaceGuids[1:] {
+		if len(x.bySpace[guid]) < len(bound) {
+			bound = x.bySpace[guid]
+		}
+	}
+	return append(slices.Clip(x.defaults), bound...), true
+}
+
+// covering returns the groups that apply wherever group narrow does,
+// including narrow itself.
+func (x scopeIndex) covering(narrow int) []int {
+	scope := x.scopes[narrow]
+	candidates, ok := x.staging.candidates(scope.staging)
+	if running, runningOK := x.running.candidates(scope.running); runningOK && (!ok || len(running) < len(candidates)) {
+		candidates, ok = running, true
+	}
+	if !ok {
+		candidates = make([]int, len(x.scopes))
+		for g := range candidates {
+			candidates[g] = g
+		}
+	}
+
+	var covering []int
+	for _, g := range candidates {
+		if x.scopes[g].covers(scope) {
+			covering = append(covering, g)
+		}
+	}
+	return covering
+}
+
+// covers reports whether s applies to every space narrow applies to.
+func (s groupScope) covers(narrow groupScope) bool {
+	return s.staging.covers(narrow.staging) && s.running.covers(narrow.running)
+}
+
+func (s lifecycleScope) covers(narrow lifecycleScope) bool {
+	if s.isDefault {
+		return true
+	}
+	if narrow.isDefault || len(narrow.spaces) > len(s.spaces) {
+		return false
+	}
+	for _, guid := range narrow.spaceGuids {
+		if !s.spaces[guid] {
+			return false
+		}
+	}
+	return true
+}
+
+type analyzedRule struct {
+	parsedRule
+	ref   RuleRef
+	group int
+}
+
+type parsedRule struct {
+	protocol     string
+	destinations []netip.Prefix
+	ports        []Ports
+	icmpType     int
+	icmpCode     int
+	log          bool
+}
+
+func parseRule(rule SecurityGroupRule) (parsedRule, error) {
+	parsed := parsedRule{
+		protocol: strings.ToLower(rule.Protocol),
+		log:      rule.Log,
+	}
+
+	switch parsed.protocol {
+	case "all":
+	case "tcp", "udp":
+		ports, err := parseRulePorts(rule.Ports)
+		if err != nil {
+			return parsedRule{}, err
+		}
+		parsed.ports = ports
+	case "icmp", "icmpv6":
+		parsed.icmpType, parsed.icmpCode = rule.Type, rule.Code
+		if parsed.icmpType == -1 {
+			parsed.icmpCode = -1
+		}
+	default:
+		return parsedRule{}, fmt.Errorf("unsupported protocol %q", rule.Protocol)
+	}
+
+	destinations, err := rule.DestinationPrefixes()
+	if err != nil {
+		return parsedRule{}, err
+	}
+	parsed.destinations = destinations
+
+	return parsed, nil
+}
+
+// parseRulePorts returns the merged port ranges of a rule. No ports means
+// every port.
+func parseRulePorts(ports string) ([]Ports, error) {
+	if strings.TrimSpace(ports) == "" {
+		return []Ports{{Start: 1, End: 65535}}, nil
+	}
+
+	var ranges []Ports
+	for _, p := range strings.Split(ports, ",") {
+		startPort, endPort, isRange := strings.Cut(strings.TrimSpace(p), "-")
+		if !isRange {
+			endPort = startPort
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(startPort))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ports %q", ports)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endPort))
+		if err != nil || start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid ports %q", ports)
+		}
+		ranges = append(ranges, Ports{Start: start, End: end})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged, nil
+}
+
+func (r parsedRule) equal(other parsedRule) bool {
+	if r.protocol != other.protocol || r.icmpType != other.icmpType || r.icmpCode != other.icmpCode || r.log != other.log {
+		return false
+	}
+	if len(r.destinations) != len(other.destinations) || len(r.ports) != len(other.ports) {
+		return false
+	}
+	for i := range r.destinations {
+		if r.destinations[i] != other.destinations[i] {
+			return false
+		}
+	}
+	for i := range r.ports {
+		if r.ports[i] != other.ports[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether every packet allowed by narrow is also allowed
+// by r.
+func (r parsedRule) covers(narrow parsedRule) bool {
+	if narrow.log && !r.log {
+		return false
+	}
+	if !prefixesCover(r.destinations, narrow.destinations) {
+		return false
+	}
+	if r.protocol == "all" {
+		return true
+	}
+	if r.protocol != narrow.protocol {
+		return false
+	}
+
+	switch r.protocol {
+	case "tcp", "udp":
+		for _, n := range narrow.ports {
+			covered := false
+			for _, b := range r.ports {
+				if b.Start <= n.Start && n.End <= b.End {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+		return true
+	default:
+		if r.icmpType == -1 {
+			return true
+		}
+		return r.icmpType == narrow.icmpType && (r.icmpCode == -1 || r.icmpCode == narrow.icmpCode)
+	}
+}
+
+// prefixesCover relies on both sides being merged by MergePrefixes, which
+// makes every aligned block inside a merged range fall within a single
+// prefix of it.
+func prefixesCover(broad, narrow []netip.Prefix) bool {
+	for _, n := range narrow {
+		covered := false
+		for _, b := range broad {
+			if b.Bits() <= n.Bits() && b.Contains(n.Addr()) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
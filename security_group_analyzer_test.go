@@ -0,0 +1,210 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AnalyzeSecurityGroups", func() {
+	var groups []policy_client.SecurityGroup
+
+	BeforeEach(func() {
+		groups = []policy_client.SecurityGroup{
+			{
+				Guid: "broad-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "tcp", Destination: "10.0.0.0/16", Ports: "1-1024"},
+					{Protocol: "all", Destination: "192.168.0.0/16"},
+				},
+				RunningSpaceGuids: []string{"space-a", "space-b"},
+			},
+			{
+				Guid: "narrow-guid",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "TCP", Destination: "10.0.1.0-10.0.1.255", Ports: "80,443"},
+					{Protocol: "udp", Destination: "192.168.1.1", Ports: "53"},
+					{Protocol: "tcp", Destination: "10.0.0.0/16", Ports: "1000-1024", Log: true},
+					{Protocol: "tcp", Destination: "10.0.0.0/8", Ports: "22"},
+				},
+				RunningSpaceGuids: []string{"space-a"},
+			},
+		}
+	})
+
+	It("reports shadowed rules", func() {
+		findings := policy_client.AnalyzeSecurityGroups(groups, nil)
+		Expect(findings).To(Equal([]policy_client.Finding{
+			{
+				Type:       policy_client.FindingShadowedRule,
+				GroupGuid:  "narrow-guid",
+				Rule:       &policy_client.RuleRef{GroupGuid: "narrow-guid", RuleIndex: 0},
+				ShadowedBy: &policy_client.RuleRef{GroupGuid: "broad-guid", RuleIndex: 0},
+				Message:    "rule 0 of security group narrow-guid is shadowed by rule 0 of security group broad-guid",
+			},
+			{
+				Type:       policy_client.FindingAllProtocolShadow,
+				GroupGuid:  "narrow-guid",
+				Rule:       &policy_client.RuleRef{GroupGuid: "narrow-guid", RuleIndex: 1},
+				ShadowedBy: &policy_client.RuleRef{GroupGuid: "broad-guid", RuleIndex: 1},
+				Message:    "rule 1 of security group narrow-guid is hidden by the all-protocol rule 1 of security group broad-guid",
+			},
+		}))
+	})
+
+	Context("when the broader group does not apply to all the same spaces", func() {
+		BeforeEach(func() {
+			groups[1].RunningSpaceGuids = []string{"space-a", "space-c"}
+		})
+
+		It("does not report the narrower rules", func() {
+			Expect(policy_client.AnalyzeSecurityGroups(groups, nil)).To(BeEmpty())
+		})
+	})
+
+	Context("when the groups are bound to many spaces", func() {
+		BeforeEach(func() {
+			groups[0].RunningSpaceGuids = []string{"space-c", "space-b", "space-a"}
+			groups[0].StagingSpaceGuids = []string{"space-d"}
+			groups[1].RunningSpaceGuids = []string{"space-b", "space-a"}
+			groups = append(groups, policy_client.SecurityGroup{
+				Guid:              "other-guid",
+				Rules:             policy_client.SecurityGroupRules{{Protocol: "all", Destination: "0.0.0.0/0"}},
+				RunningSpaceGuids: []string{"space-a"},
+			})
+		})
+
+		It("only shadows rules with groups bound to all of them", func() {
+			findings := policy_client.AnalyzeSecurityGroups(groups, nil)
+			Expect(findings).To(HaveLen(2))
+			Expect(*findings[0].ShadowedBy).To(Equal(policy_client.RuleRef{GroupGuid: "broad-guid", RuleIndex: 0}))
+			Expect(*findings[1].ShadowedBy).To(Equal(policy_client.RuleRef{GroupGuid: "broad-guid", RuleIndex: 1}))
+		})
+	})
+
+	Context("when the broader group is a default group", func() {
+		BeforeEach(func() {
+			groups[0].RunningSpaceGuids = nil
+			groups[0].RunningDefault = true
+			groups[1].StagingDefault = true
+		})
+
+		It("only shadows rules when it is a default for the same lifecycles", func() {
+			Expect(policy_client.AnalyzeSecurityGroups(groups, nil)).To(BeEmpty())
+
+			groups[0].StagingDefault = true
+			Expect(policy_client.AnalyzeSecurityGroups(groups, nil)).To(HaveLen(2))
+		})
+	})
+
+	Context("when rules are duplicated", func() {
+		BeforeEach(func() {
+			groups = []policy_client.SecurityGroup{
+				{
+					Guid: "first-guid",
+					Rules: policy_client.SecurityGroupRules{
+						{Protocol: "icmp", Destination: "10.0.0.0/24", Type: 8, Code: -1},
+						{Protocol: "icmp", Destination: "10.0.0.0-10.0.0.255", Type: 8, Code: -1},
+					},
+					RunningSpaceGuids: []string{"space-a"},
+				},
+				{
+					Guid: "second-guid",
+					Rules: policy_client.SecurityGroupRules{
+						{Protocol: "icmp", Destination: "10.0.0.0/24", Type: 8, Code: -1},
+						{Protocol: "icmp", Destination: "10.0.0.0/24", Type: 8, Code: 0},
+					},
+					RunningSpaceGuids: []string{"space-a"},
+				},
+			}
+		})
+
+		It("keeps the first and reports the rest", func() {
+			findings := policy_client.AnalyzeSecurityGroups(groups, nil)
+			Expect(findings).To(HaveLen(3))
+			Expect(findings[0].Type).To(Equal(policy_client.FindingDuplicateRule))
+			Expect(*findings[0].Rule).To(Equal(policy_client.RuleRef{GroupGuid: "first-guid", RuleIndex: 1}))
+			Expect(*findings[0].ShadowedBy).To(Equal(policy_client.RuleRef{GroupGuid: "first-guid", RuleIndex: 0}))
+			Expect(findings[1].Type).To(Equal(policy_client.FindingDuplicateRule))
+			Expect(*findings[1].Rule).To(Equal(policy_client.RuleRef{GroupGuid: "second-guid", RuleIndex: 0}))
+			Expect(findings[2].Type).To(Equal(policy_client.FindingShadowedRule))
+			Expect(*findings[2].Rule).To(Equal(policy_client.RuleRef{GroupGuid: "second-guid", RuleIndex: 1}))
+		})
+	})
+
+	Context("when known spaces are supplied", func() {
+		It("reports bindings to unknown spaces", func() {
+			groups[1].StagingSpaceGuids = []string{"space-z"}
+			findings := policy_client.AnalyzeSecurityGroups(groups, []string{"space-a"})
+			Expect(findings).To(Equal([]policy_client.Finding{
+				{
+					Type:      policy_client.FindingUnknownSpace,
+					GroupGuid: "broad-guid",
+					SpaceGuid: "space-b",
+					Lifecycle: "running",
+					Message:   "security group broad-guid is bound to unknown running space space-b",
+				},
+				{
+					Type:      policy_client.FindingUnknownSpace,
+					GroupGuid: "narrow-guid",
+					SpaceGuid: "space-z",
+					Lifecycle: "staging",
+					Message:   "security group narrow-guid is bound to unknown staging space space-z",
+				},
+			}))
+		})
+	})
+
+	Context("when a rule is invalid", func() {
+		It("reports it and skips it", func() {
+			groups[0].Rules[0].Ports = "80-"
+			findings := policy_client.AnalyzeSecurityGroups(groups, nil)
+			Expect(findings[0]).To(Equal(policy_client.Finding{
+				Type:      policy_client.FindingInvalidRule,
+				GroupGuid: "broad-guid",
+				Rule:      &policy_client.RuleRef{GroupGuid: "broad-guid", RuleIndex: 0},
+				Message:   `invalid ports "80-"`,
+			}))
+			Expect(findings).To(HaveLen(2))
+		})
+	})
+
+	It("produces findings that marshal to JSON", func() {
+		findings := policy_client.AnalyzeSecurityGroups(groups, nil)
+		data, err := json.Marshal(findings[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"type": "shadowed_rule",
+			"group_guid": "narrow-guid",
+			"rule": {"group_guid": "narrow-guid", "rule_index": 0},
+			"shadowed_by": {"group_guid": "broad-guid", "rule_index": 0},
+			"message": "rule 0 of security group narrow-guid is shadowed by rule 0 of security group broad-guid"
+		}`))
+	})
+})
+
+func BenchmarkAnalyzeSecurityGroups(b *testing.B) {
+	groups := make([]policy_client.SecurityGroup, 3000)
+	for i := range groups {
+		groups[i] = policy_client.SecurityGroup{
+			Guid: fmt.Sprintf("group-%d", i),
+			Rules: policy_client.SecurityGroupRules{
+				{Protocol: "tcp", Destination: "0.0.0.0/0", Ports: "443"},
+				{Protocol: "udp", Destination: fmt.Sprintf("10.%d.%d.0/24", i/256, i%256), Ports: "53"},
+				{Protocol: "icmp", Destination: "10.0.0.0/8", Type: -1},
+			},
+			RunningSpaceGuids: []string{fmt.Sprintf("space-%d", i), "space-shared"},
+			StagingSpaceGuids: []string{fmt.Sprintf("space-%d", i)},
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		policy_client.AnalyzeSecurityGroups(groups, nil)
+	}
+}
@@ -0,0 +1,77 @@
+package policy_client
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Canonical returns a copy of the security group with sorted space GUIDs,
+// lowercased rule protocols and sorted rules. Two groups with the same
+// content have equal canonical forms regardless of the order the policy
+// server returned them in.
+func (sg SecurityGroup) Canonical() SecurityGroup {
+	canonical := sg
+
+	canonical.Rules = make(SecurityGroupRules, len(sg.Rules))
+	for i, rule := range sg.Rules {
+		rule.Protocol = strings.ToLower(rule.Protocol)
+		canonical.Rules[i] = rule
+	}
+	slices.SortFunc(canonical.Rules, compareSecurityGroupRules)
+
+	canonical.StagingSpaceGuids = sortedCopy(sg.StagingSpaceGuids)
+	canonical.RunningSpaceGuids = sortedCopy(sg.RunningSpaceGuids)
+
+	return canonical
+}
+
+// CanonicalSecurityGroups returns the canonical form of every group,
+// ordered by GUID.
+func CanonicalSecurityGroups(groups []SecurityGroup) []SecurityGroup {
+	canonical := make([]SecurityGroup, len(groups))
+	for i, sg := range groups {
+		canonical[i] = sg.Canonical()
+	}
+	slices.SortStableFunc(canonical, func(a, b SecurityGroup) int {
+		return cmp.Compare(a.Guid, b.Guid)
+	})
+	return canonical
+}
+
+// SecurityGroupsFingerprint returns the hex encoded SHA-256 of the
+// canonical form of a snapshot. It only changes when the content does.
+func SecurityGroupsFingerprint(groups []SecurityGroup) string {
+	return fingerprint(CanonicalSecurityGroups(groups))
+}
+
+func compareSecurityGroupRules(a, b SecurityGroupRule) int {
+	return cmp.Or(
+		cmp.Compare(a.Protocol, b.Protocol),
+		cmp.Compare(a.Destination, b.Destination),
+		cmp.Compare(a.Ports, b.Ports),
+		cmp.Compare(a.Type, b.Type),
+		cmp.Compare(a.Code, b.Code),
+		cmp.Compare(a.Description, b.Description),
+		compareBool(a.Log, b.Log),
+	)
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// sortedCopy never returns nil, so empty and missing lists encode the same.
+func sortedCopy(values []string) []string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	slices.Sort(sorted)
+	return sorted
+}
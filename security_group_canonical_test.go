@@ -0,0 +1,91 @@
+package policy_client_test
+
+import (
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SecurityGroup canonical form", func() {
+	var groups []policy_client.SecurityGroup
+
+	BeforeEach(func() {
+		groups = []policy_client.SecurityGroup{
+			{
+				Guid: "sg-2-guid",
+				Name: "security-group-2",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "UDP", Destination: "10.0.0.1", Ports: "53"},
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443", Log: true},
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443"},
+				},
+				RunningSpaceGuids: []string{"space-b", "space-a"},
+			},
+			{
+				Guid:           "public-asg-guid",
+				Name:           "public_networks",
+				Rules:          policy_client.SecurityGroupRules{{Protocol: "all", Destination: "0.0.0.0-9.255.255.255"}},
+				StagingDefault: true,
+				RunningDefault: true,
+			},
+		}
+	})
+
+	Describe("Canonical", func() {
+		It("sorts the rules and space guids and lowercases protocols", func() {
+			canonical := groups[0].Canonical()
+			Expect(canonical).To(Equal(policy_client.SecurityGroup{
+				Guid: "sg-2-guid",
+				Name: "security-group-2",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443"},
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443", Log: true},
+					{Protocol: "udp", Destination: "10.0.0.1", Ports: "53"},
+				},
+				StagingSpaceGuids: []string{},
+				RunningSpaceGuids: []string{"space-a", "space-b"},
+			}))
+		})
+
+		It("does not modify the original", func() {
+			groups[0].Canonical()
+			Expect(groups[0].Rules[0].Protocol).To(Equal("UDP"))
+			Expect(groups[0].RunningSpaceGuids).To(Equal([]string{"space-b", "space-a"}))
+		})
+	})
+
+	Describe("CanonicalSecurityGroups", func() {
+		It("orders the groups by guid", func() {
+			canonical := policy_client.CanonicalSecurityGroups(groups)
+			Expect(canonical).To(HaveLen(2))
+			Expect(canonical[0].Guid).To(Equal("public-asg-guid"))
+			Expect(canonical[1]).To(Equal(groups[0].Canonical()))
+		})
+	})
+
+	Describe("SecurityGroupsFingerprint", func() {
+		It("is a hex encoded sha256", func() {
+			Expect(policy_client.SecurityGroupsFingerprint(groups)).To(MatchRegexp("^[0-9a-f]{64}$"))
+		})
+
+		It("ignores ordering and protocol case", func() {
+			reordered := []policy_client.SecurityGroup{groups[1], groups[0]}
+			reordered[1].Rules = policy_client.SecurityGroupRules{
+				{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443"},
+				{Protocol: "udp", Destination: "10.0.0.1", Ports: "53"},
+				{Protocol: "TCP", Destination: "10.0.11.0/24", Ports: "443", Log: true},
+			}
+			reordered[1].RunningSpaceGuids = []string{"space-a", "space-b"}
+			reordered[0].StagingSpaceGuids = []string{}
+
+			Expect(policy_client.SecurityGroupsFingerprint(reordered)).To(Equal(policy_client.SecurityGroupsFingerprint(groups)))
+		})
+
+		It("changes when the content changes", func() {
+			before := policy_client.SecurityGroupsFingerprint(groups)
+			groups[1].RunningDefault = false
+			Expect(policy_client.SecurityGroupsFingerprint(groups)).NotTo(Equal(before))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package policy_client
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type SecurityGroupField string
+
+const (
+	SecurityGroupFieldName              SecurityGroupField = "name"
+	SecurityGroupFieldRules             SecurityGroupField = "rules"
+	SecurityGroupFieldStagingDefault    SecurityGroupField = "staging_default"
+	SecurityGroupFieldRunningDefault    SecurityGroupField = "running_default"
+	SecurityGroupFieldStagingSpaceGuids SecurityGroupField = "staging_space_guids"
+	SecurityGroupFieldRunningSpaceGuids SecurityGroupField = "running_space_guids"
+)
+
+type SecurityGroupChange struct {
+	Guid   string               `json:"guid"`
+	Fields []SecurityGroupField `json:"fields"`
+}
+
+type SecurityGroupsDiff struct {
+	Added   []string              `json:"added"`
+	Removed []string              `json:"removed"`
+	Changed []SecurityGroupChange `json:"changed"`
+
+	// StagingSpaceGuids and RunningSpaceGuids are the spaces whose
+	// effective rules differ between the two snapshots.
+	StagingSpaceGuids []string `json:"staging_space_guids"`
+	RunningSpaceGuids []string `json:"running_space_guids"`
+
+	// AllStagingSpaces and AllRunningSpaces are set when the rules of the
+	// default groups changed. That affects every space, including ones
+	// that are not bound to any group and so cannot be listed above.
+	AllStagingSpaces bool `json:"all_staging_spaces"`
+	AllRunningSpaces bool `json:"all_running_spaces"`
+}
+
+func (d SecurityGroupsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffSecurityGroups compares two snapshots, such as the results of
+// GetSecurityGroupsForSpace before and after GetSecurityGroupsLastUpdated
+// moves. Rule and space GUID order is ignored, as is the protocol case.
+// Rule descriptions are reported as rule changes but do not affect the
+// effective rules of a space.
+func DiffSecurityGroups(old, new []SecurityGroup) SecurityGroupsDiff {
+	oldByGuid := securityGroupsByGuid(old)
+	newByGuid := securityGroupsByGuid(new)
+
+	var diff SecurityGroupsDiff
+	candidates := map[string][]string{"staging": nil, "running": nil}
+	touch := func(sg SecurityGroup) {
+		candidates["staging"] = append(candidates["staging"], sg.StagingSpaceGuids...)
+		candidates["running"] = append(candidates["running"], sg.RunningSpaceGuids...)
+	}
+
+	for guid, oldGroup := range oldByGuid {
+		newGroup, ok := newByGuid[guid]
+		if !ok {
+			diff.Removed = append(diff.Removed, guid)
+			touch(oldGroup)
+			continue
+		}
+		fields := changedSecurityGroupFields(oldGroup, newGroup)
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, SecurityGroupChange{Guid: guid, Fields: fields})
+			touch(oldGroup)
+			touch(newGroup)
+		}
+	}
+	for guid, newGroup := range newByGuid {
+		if _, ok := oldByGuid[guid]; !ok {
+			diff.Added = append(diff.Added, guid)
+			touch(newGroup)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Guid < diff.Changed[j].Guid
+	})
+
+	oldStaging, newStaging := newEffectiveRules(old, staging), newEffectiveRules(new, staging)
+	oldRunning, newRunning := newEffectiveRules(old, running), newEffectiveRules(new, running)
+
+	diff.AllStagingSpaces = !reflect.DeepEqual(ruleSet(oldStaging.defaults, true), ruleSet(newStaging.defaults, true))
+	diff.AllRunningSpaces = !reflect.DeepEqual(ruleSet(oldRunning.defaults, true), ruleSet(newRunning.defaults, true))
+	if diff.AllStagingSpaces {
+		candidates["staging"] = append(oldStaging.spaceGuids(), newStaging.spaceGuids()...)
+	}
+	if diff.AllRunningSpaces {
+		candidates["running"] = append(oldRunning.spaceGuids(), newRunning.spaceGuids()...)
+	}
+	diff.StagingSpaceGuids = changedSpaces(candidates["staging"], oldStaging, newStaging)
+	diff.RunningSpaceGuids = changedSpaces(candidates["running"], oldRunning, newRunning)
+
+	return diff
+}
+
+func securityGroupsByGuid(groups []SecurityGroup) map[string]SecurityGroup {
+	byGuid := make(map[string]SecurityGroup, len(groups))
+	for _, sg := range groups {
+		byGuid[sg.Guid] = sg
+	}
+	return byGuid
+}
+
+func changedSecurityGroupFields(old, new SecurityGroup) []SecurityGroupField {
+	var fields []SecurityGroupField
+	if old.Name != new.Name {
+		fields = append(fields, SecurityGroupFieldName)
+	}
+	if !reflect.DeepEqual(ruleSet(old.Rules, false), ruleSet(new.Rules, false)) {
+		fields = append(fields, SecurityGroupFieldRules)
+	}
+	if old.StagingDefault != new.StagingDefault {
+		fields = append(fields, SecurityGroupFieldStagingDefault)
+	}
+	if old.RunningDefault != new.RunningDefault {
+		fields = append(fields, SecurityGroupFieldRunningDefault)
+	}
+	if !reflect.DeepEqual(stringSet(old.StagingSpaceGuids), stringSet(new.StagingSpaceGuids)) {
+		fields = append(fields, SecurityGroupFieldStagingSpaceGuids)
+	}
+	if !reflect.DeepEqual(stringSet(old.RunningSpaceGuids), stringSet(new.RunningSpaceGuids)) {
+		fields = append(fields, SecurityGroupFieldRunningSpaceGuids)
+	}
+	return fields
+}
+
+type lifecycle int
+
+const (
+	staging lifecycle = iota
+	running
+)
+
+// effectiveRules indexes the rules of a snapshot so the rules that apply
+// to a space can be computed without walking every group.
+type effectiveRules struct {
+	defaults []SecurityGroupRule
+	bound    map[string][]SecurityGroupRule
+}
+
+func newEffectiveRules(groups []SecurityGroup, l lifecycle) effectiveRules {
+	e := effectiveRules{bound: map[string][]SecurityGroupRule{}}
+	for _, sg := range groups {
+		isDefault, spaceGuids := sg.StagingDefault, sg.StagingSpaceGuids
+		if l == running {
+			isDefault, spaceGuids = sg.RunningDefault, sg.RunningSpaceGuids
+		}
+		if isDefault {
+			e.defaults = append(e.defaults, sg.Rules...)
+		}
+		for _, guid := range spaceGuids {
+			e.bound[guid] = append(e.bound[guid], sg.Rules...)
+		}
+	}
+	return e
+}
+
+func (e effectiveRules) forSpace(spaceGuid string) map[SecurityGroupRule]bool {
+	rules := ruleSet(e.defaults, true)
+	for rule := range ruleSet(e.bound[spaceGuid], true) {
+		rules[rule] = true
+	}
+	return rules
+}
+
+func (e effectiveRules) spaceGuids() []string {
+	guids := make([]string, 0, len(e.bound))
+	for guid := range e.bound {
+		guids = append(guids, guid)
+	}
+	return guids
+}
+
+func changedSpaces(candidates []string, old, new effectiveRules) []string {
+	var changed []string
+	for guid := range stringSet(candidates) {
+		if !reflect.DeepEqual(old.forSpace(guid), new.forSpace(guid)) {
+			changed = append(changed, guid)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func ruleSet(rules []SecurityGroupRule, ignoreDescription bool) map[SecurityGroupRule]bool {
+	set := make(map[SecurityGroupRule]bool, len(rules))
+	for _, rule := range rules {
+		rule.Protocol = strings.ToLower(rule.Protocol)
+		if ignoreDescription {
+			rule.Description = ""
+		}
+		set[rule] = true
+	}
+	return set
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,144 @@
+package policy_client_test
+
+import (
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffSecurityGroups", func() {
+	var old []policy_client.SecurityGroup
+
+	BeforeEach(func() {
+		old = []policy_client.SecurityGroup{
+			{
+				Guid: "public-asg-guid",
+				Name: "public_networks",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "all", Destination: "0.0.0.0-9.255.255.255"},
+				},
+				StagingDefault: true,
+				RunningDefault: true,
+			},
+			{
+				Guid: "sg-1-guid",
+				Name: "security-group-1",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "80"},
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "443"},
+				},
+				StagingSpaceGuids: []string{"space-a"},
+				RunningSpaceGuids: []string{"space-a", "space-b"},
+			},
+			{
+				Guid: "sg-2-guid",
+				Name: "security-group-2",
+				Rules: policy_client.SecurityGroupRules{
+					{Protocol: "tcp", Destination: "10.0.11.0/24", Ports: "80"},
+				},
+				RunningSpaceGuids: []string{"space-b"},
+			},
+		}
+	})
+
+	copySnapshot := func(groups []policy_client.SecurityGroup) []policy_client.SecurityGroup {
+		result := make([]policy_client.SecurityGroup, len(groups))
+		for i, sg := range groups {
+			sg.Rules = append(policy_client.SecurityGroupRules{}, sg.Rules...)
+			sg.StagingSpaceGuids = append([]string{}, sg.StagingSpaceGuids...)
+			sg.RunningSpaceGuids = append([]string{}, sg.RunningSpaceGuids...)
+			result[i] = sg
+		}
+		return result
+	}
+
+	Context("when only the order differs", func() {
+		It("reports no changes", func() {
+			current := copySnapshot(old)
+			current[0], current[2] = current[2], current[0]
+			current[1].Rules[0], current[1].Rules[1] = current[1].Rules[1], current[1].Rules[0]
+			current[1].Rules[0].Protocol = "TCP"
+			current[1].RunningSpaceGuids = []string{"space-b", "space-a"}
+
+			diff := policy_client.DiffSecurityGroups(old, current)
+			Expect(diff.Empty()).To(BeTrue())
+			Expect(diff.StagingSpaceGuids).To(BeEmpty())
+			Expect(diff.RunningSpaceGuids).To(BeEmpty())
+			Expect(diff.AllStagingSpaces).To(BeFalse())
+			Expect(diff.AllRunningSpaces).To(BeFalse())
+		})
+	})
+
+	Context("when a group's rules change", func() {
+		It("reports the group and the spaces whose effective rules changed", func() {
+			current := copySnapshot(old)
+			current[1].Rules = current[1].Rules[1:]
+
+			diff := policy_client.DiffSecurityGroups(old, current)
+			Expect(diff.Changed).To(Equal([]policy_client.SecurityGroupChange{
+				{Guid: "sg-1-guid", Fields: []policy_client.SecurityGroupField{policy_client.SecurityGroupFieldRules}},
+			}))
+			Expect(diff.StagingSpaceGuids).To(Equal([]string{"space-a"}))
+			// space-b still gets the removed rule from sg-2-guid
+			Expect(diff.RunningSpaceGuids).To(Equal([]string{"space-a"}))
+		})
+	})
+
+	Context("when only a rule description changes", func() {
+		It("reports the rule change but no space changes", func() {
+			current := copySnapshot(old)
+			current[2].Rules[0].Description = "http"
+
+			diff := policy_client.DiffSecurityGroups(old, current)
+			Expect(diff.Changed).To(Equal([]policy_client.SecurityGroupChange{
+				{Guid: "sg-2-guid", Fields: []policy_client.SecurityGroupField{policy_client.SecurityGroupFieldRules}},
+			}))
+			Expect(diff.RunningSpaceGuids).To(BeEmpty())
+		})
+	})
+
+	Context("when bindings and default flags change", func() {
+		It("reports each changed field", func() {
+			current := copySnapshot(old)
+			current[0].Name = "public"
+			current[0].StagingDefault = false
+			current[2].StagingSpaceGuids = []string{"space-c"}
+			current[2].RunningSpaceGuids = []string{"space-c"}
+
+			diff := policy_client.DiffSecurityGroups(old, current)
+			Expect(diff.Changed).To(Equal([]policy_client.SecurityGroupChange{
+				{Guid: "public-asg-guid", Fields: []policy_client.SecurityGroupField{
+					policy_client.SecurityGroupFieldName,
+					policy_client.SecurityGroupFieldStagingDefault,
+				}},
+				{Guid: "sg-2-guid", Fields: []policy_client.SecurityGroupField{
+					policy_client.SecurityGroupFieldStagingSpaceGuids,
+					policy_client.SecurityGroupFieldRunningSpaceGuids,
+				}},
+			}))
+			Expect(diff.AllStagingSpaces).To(BeTrue())
+			Expect(diff.AllRunningSpaces).To(BeFalse())
+			Expect(diff.StagingSpaceGuids).To(Equal([]string{"space-a", "space-c"}))
+			Expect(diff.RunningSpaceGuids).To(Equal([]string{"space-c"}))
+		})
+	})
+
+	Context("when groups are added and removed", func() {
+		It("reports them and the spaces they were bound to", func() {
+			current := copySnapshot(old)[:2]
+			current = append(current, policy_client.SecurityGroup{
+				Guid:              "sg-3-guid",
+				Rules:             policy_client.SecurityGroupRules{{Protocol: "udp", Destination: "10.0.0.1", Ports: "53"}},
+				StagingSpaceGuids: []string{"space-d"},
+			})
+
+			diff := policy_client.DiffSecurityGroups(old, current)
+			Expect(diff.Added).To(Equal([]string{"sg-3-guid"}))
+			Expect(diff.Removed).To(Equal([]string{"sg-2-guid"}))
+			Expect(diff.Changed).To(BeEmpty())
+			Expect(diff.StagingSpaceGuids).To(Equal([]string{"space-d"}))
+			Expect(diff.RunningSpaceGuids).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package policy_client
+
+import (
+	"errors"
+	"slices"
+)
+
+// Selector picks policies by their apps, protocol and ports. Empty fields
+// match every policy.
+type Selector struct {
+	// AppIDs matches policies with any of the apps as source or
+	// destination.
+	AppIDs         []string
+	SourceIDs      []string
+	DestinationIDs []string
+	Protocol       string
+	// Ports matches policies whose port range lies within it.
+	Ports Ports
+}
+
+func (s Selector) Matches(p Policy) bool {
+	if len(s.AppIDs) > 0 && !slices.Contains(s.AppIDs, p.Source.ID) && !slices.Contains(s.AppIDs, p.Destination.ID) {
+		return false
+	}
+	if len(s.SourceIDs) > 0 && !slices.Contains(s.SourceIDs, p.Source.ID) {
+		return false
+	}
+	if len(s.DestinationIDs) > 0 && !slices.Contains(s.DestinationIDs, p.Destination.ID) {
+		return false
+	}
+	if s.Protocol != "" && s.Protocol != p.Destination.Protocol {
+		return false
+	}
+	if s.Ports != (Ports{}) && (p.Destination.Ports.Start < s.Ports.Start || p.Destination.Ports.End > s.Ports.End) {
+		return false
+	}
+	return true
+}
+
+// DeletePoliciesMatching deletes every policy matching selector and
+// returns them. A selector that matches every policy is refused.
+func (c *ExternalClient) DeletePoliciesMatching(token string, selector Selector) ([]Policy, error) {
+	if selector.matchesEverything() {
+		return nil, errors.New("refusing to delete policies with an empty selector")
+	}
+
+	policies, err := c.getPoliciesMatching(token, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return policies, nil
+	}
+	err = c.DeletePolicies(token, policies)
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (s Selector) matchesEverything() bool {
+	return len(s.AppIDs) == 0 && len(s.SourceIDs) == 0 && len(s.DestinationIDs) == 0 && s.Protocol == "" && s.Ports == (Ports{})
+}
+
+// getPoliciesMatching asks the server only for the apps in scope when it
+// names any, then filters to the rest of scope.
+func (c *ExternalClient) getPoliciesMatching(token string, scope Selector) ([]Policy, error) {
+	var (
+		policies []Policy
+		err      error
+	)
+	if ids := slices.Concat(scope.AppIDs, scope.SourceIDs, scope.DestinationIDs); len(ids) > 0 {
+		slices.Sort(ids)
+		policies, err = c.GetPoliciesByID(token, slices.Compact(ids)...)
+	} else {
+		policies, err = c.GetPolicies(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := []Policy{}
+	for _, policy := range policies {
+		if scope.Matches(policy) {
+			scoped = append(scoped, policy)
+		}
+	}
+	return scoped, nil
+}
@@ -0,0 +1,113 @@
+package policy_client_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	hfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/policy_client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Selector", func() {
+	It("matches every policy when empty", func() {
+		Expect(policy_client.Selector{}.Matches(testPolicy("a", "b", 1, 2))).To(BeTrue())
+	})
+
+	It("matches each field", func() {
+		policy := testPolicy("app-a", "app-b", 8080, 8090)
+		Expect(policy_client.Selector{DestinationIDs: []string{"app-b"}}.Matches(policy)).To(BeTrue())
+		Expect(policy_client.Selector{DestinationIDs: []string{"app-c"}}.Matches(policy)).To(BeFalse())
+		Expect(policy_client.Selector{AppIDs: []string{"app-a"}}.Matches(policy)).To(BeTrue())
+		Expect(policy_client.Selector{AppIDs: []string{"app-b"}}.Matches(policy)).To(BeTrue())
+		Expect(policy_client.Selector{AppIDs: []string{"app-c"}}.Matches(policy)).To(BeFalse())
+		Expect(policy_client.Selector{Protocol: "udp"}.Matches(policy)).To(BeFalse())
+		Expect(policy_client.Selector{Ports: policy_client.Ports{Start: 8000, End: 9000}}.Matches(policy)).To(BeTrue())
+		Expect(policy_client.Selector{Ports: policy_client.Ports{Start: 8085, End: 9000}}.Matches(policy)).To(BeFalse())
+	})
+})
+
+var _ = Describe("DeletePoliciesMatching", func() {
+	var (
+		client     *policy_client.ExternalClient
+		jsonClient *hfakes.JSONClient
+		current    []policy_client.Policy
+		deleted    []policy_client.Policy
+		getRoutes  []string
+	)
+
+	BeforeEach(func() {
+		current = []policy_client.Policy{
+			testPolicy("app-a", "app-b", 8080, 8080),
+			testPolicy("app-c", "app-a", 9000, 9000),
+			testPolicy("app-c", "app-b", 8080, 8080),
+		}
+		deleted = nil
+		getRoutes = nil
+
+		jsonClient = &hfakes.JSONClient{}
+		jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+			if method == "GET" {
+				getRoutes = append(getRoutes, route)
+				body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": current})
+				return json.Unmarshal(body, respData)
+			}
+			Expect(route).To(Equal("/networking/v1/external/policies/delete"))
+			deleted = append(deleted, reqData.(map[string][]policy_client.Policy)["policies"]...)
+			return nil
+		}
+		client = &policy_client.ExternalClient{
+			JsonClient: jsonClient,
+			Chunker:    &policy_client.SimpleChunker{ChunkSize: 1},
+		}
+	})
+
+	It("deletes the policies of an app in chunks", func() {
+		current = current[:2]
+		policies, err := client.DeletePoliciesMatching("some-token", policy_client.Selector{AppIDs: []string{"app-a"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRoutes).To(Equal([]string{"/networking/v1/external/policies?id=app-a"}))
+		Expect(policies).To(Equal(current))
+		Expect(deleted).To(Equal(current))
+		Expect(jsonClient.DoCallCount()).To(Equal(3))
+	})
+
+	It("deletes every policy on a port", func() {
+		selector := policy_client.Selector{Protocol: "tcp", Ports: policy_client.Ports{Start: 8080, End: 8080}}
+		policies, err := client.DeletePoliciesMatching("some-token", selector)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRoutes).To(Equal([]string{"/networking/v1/external/policies"}))
+		Expect(policies).To(Equal([]policy_client.Policy{current[0], current[2]}))
+		Expect(deleted).To(Equal(policies))
+		Expect(jsonClient.DoCallCount()).To(Equal(3))
+	})
+
+	It("does not post when nothing matches", func() {
+		policies, err := client.DeletePoliciesMatching("some-token", policy_client.Selector{Protocol: "udp"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(BeEmpty())
+		Expect(jsonClient.DoCallCount()).To(Equal(1))
+	})
+
+	It("refuses an empty selector", func() {
+		_, err := client.DeletePoliciesMatching("some-token", policy_client.Selector{})
+		Expect(err).To(MatchError("refusing to delete policies with an empty selector"))
+		Expect(jsonClient.DoCallCount()).To(Equal(0))
+	})
+
+	Context("when deleting fails", func() {
+		It("returns the error", func() {
+			jsonClient.DoStub = func(method, route string, reqData, respData interface{}, token string) error {
+				if method == "GET" {
+					body, _ := json.Marshal(map[string][]policy_client.Policy{"policies": current})
+					return json.Unmarshal(body, respData)
+				}
+				return errors.New("banana")
+			}
+			_, err := client.DeletePoliciesMatching("some-token", policy_client.Selector{SourceIDs: []string{"app-c"}})
+			Expect(err).To(MatchError("banana"))
+		})
+	})
+})